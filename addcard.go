@@ -0,0 +1,258 @@
+package rozetkapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	ErrAddCardPending error = errors.New("add card is still pending")
+)
+
+// AddCardError is the failure of adding a card, as reported by the gateway.
+type AddCardError struct {
+	CustomerID  string
+	OptionID    string
+	Status      PaymentStatus
+	StatusCode  PaymentStatusCode
+	Description string
+}
+
+func (e *AddCardError) Error() string {
+	reason := firstNonEmpty(string(e.StatusCode), string(e.Status))
+	if e.Description != "" {
+		return fmt.Sprintf("add card failed: %s (%s)", reason, e.Description)
+	}
+	return fmt.Sprintf("add card failed: %s", reason)
+}
+
+// AddCardAttempt is a card being added to the customer's wallet.
+type AddCardAttempt struct {
+	CustomerID string
+
+	// Option id of the card, if the gateway reported it when the attempt started.
+	OptionID string
+
+	// Set when the customer has to pass verification, usually a redirect to the 3DS page.
+	ActionRequired bool
+	Action         PaymentUserAction
+
+	done  chan struct{}
+	entry WalletEntry
+	err   error
+}
+
+// Returns a channel closed once the attempt is resolved.
+func (a *AddCardAttempt) Done() <-chan struct{} {
+	return a.done
+}
+
+// Returns the saved card, an *AddCardError if the gateway declined it,
+// or ErrAddCardPending if the attempt is not resolved yet.
+func (a *AddCardAttempt) Result() (WalletEntry, error) {
+	select {
+	case <-a.done:
+		return a.entry, a.err
+	default:
+		return WalletEntry{}, ErrAddCardPending
+	}
+}
+
+// Waits until the attempt is resolved or the context is done.
+func (a *AddCardAttempt) Wait(ctx context.Context) (WalletEntry, error) {
+	select {
+	case <-a.done:
+		return a.entry, a.err
+	case <-ctx.Done():
+		return WalletEntry{}, ctx.Err()
+	}
+}
+
+func (a *AddCardAttempt) resolve(entry WalletEntry, err error) {
+	a.entry, a.err = entry, err
+	close(a.done)
+}
+
+// AddCardFlow adds cards to customer wallets, correlating the wallet callbacks with the attempts.
+type AddCardFlow struct {
+	client *Client
+
+	mu      sync.Mutex
+	pending map[string][]*AddCardAttempt
+}
+
+func NewAddCardFlow(client *Client) *AddCardFlow {
+	return &AddCardFlow{client: client, pending: map[string][]*AddCardAttempt{}}
+}
+
+// Starts adding the card from the cc_token payment method of the schema.
+// If the attempt requires verification, redirect the customer to Action.Value
+// and wait for the attempt to be resolved by the wallet callback.
+// The attempt is pending from before the request, so a callback arriving ahead of the response resolves it.
+func (f *AddCardFlow) Start(customerID string, schema *AddWalletCustomerSchema) (*AddCardAttempt, error) {
+	a := &AddCardAttempt{CustomerID: customerID, done: make(chan struct{})}
+	f.mu.Lock()
+	f.pending[customerID] = append(f.pending[customerID], a)
+	f.mu.Unlock()
+
+	resp, err := f.client.AddWalletCustomerPayment(customerID, schema)
+	if err != nil {
+		f.release(a)
+		return nil, err
+	}
+
+	f.mu.Lock()
+	a.OptionID = resp.PaymentMethod.OptionID
+	a.ActionRequired = resp.ActionRequired
+	a.Action = resp.Action
+	f.mu.Unlock()
+
+	// Resolved here unless a callback did it first.
+	switch {
+	case resp.Status == PaymentStatusSuccess && !resp.ActionRequired:
+		if f.release(a) {
+			a.resolve(WalletEntry(resp.PaymentMethod), nil)
+		}
+	case resp.Status == PaymentStatusFailure:
+		if f.release(a) {
+			a.resolve(WalletEntry{}, &AddCardError{
+				CustomerID: customerID,
+				OptionID:   resp.PaymentMethod.OptionID,
+				Status:     resp.Status,
+			})
+		}
+	}
+	return a, nil
+}
+
+// Resolves the attempt the callback belongs to: the one with the same option id,
+// otherwise the oldest pending attempt of the customer.
+// Reports whether a pending attempt was found.
+func (f *AddCardFlow) HandleCallback(cb *WalletCallback) bool {
+	if cb == nil {
+		return false
+	}
+	f.mu.Lock()
+	a := f.take(cb.ExternalID, cb.PaymentMethod.OptionID)
+	f.mu.Unlock()
+	if a == nil {
+		return false
+	}
+
+	switch cb.Status {
+	case PaymentStatusSuccess:
+		a.resolve(WalletEntry(cb.PaymentMethod), nil)
+	case PaymentStatusFailure:
+		a.resolve(WalletEntry{}, &AddCardError{
+			CustomerID:  cb.ExternalID,
+			OptionID:    cb.PaymentMethod.OptionID,
+			Status:      cb.Status,
+			StatusCode:  cb.StatusCode,
+			Description: cb.StatusDescription,
+		})
+	default:
+		// Not final yet, keep waiting for the next callback.
+		f.mu.Lock()
+		f.pending[a.CustomerID] = append([]*AddCardAttempt{a}, f.pending[a.CustomerID]...)
+		f.mu.Unlock()
+	}
+	return true
+}
+
+// Resolves the attempt from the customer's wallet, for when the callback got lost.
+// Reports whether the card was found, an attempt already declined returns its *AddCardError.
+func (f *AddCardFlow) Check(a *AddCardAttempt) (bool, error) {
+	if _, err := a.Result(); err != ErrAddCardPending {
+		return err == nil, err
+	}
+	f.mu.Lock()
+	optionID := a.OptionID
+	f.mu.Unlock()
+	if optionID == "" {
+		return false, nil
+	}
+	info, err := f.client.GetWalletCustomerPaymentInfo(a.CustomerID)
+	if code, ok := ErrorStatusCode(err); ok && code == StatusCodeCustomerProfileNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range info.Wallet {
+		if entry.OptionID != optionID {
+			continue
+		}
+		if f.release(a) {
+			a.resolve(entry, nil)
+			return true, nil
+		}
+		// Resolved by a callback in the meantime.
+		if _, err := a.Result(); err != ErrAddCardPending {
+			return err == nil, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Stops waiting for the attempt, a later callback for it is ignored.
+func (f *AddCardFlow) Abandon(a *AddCardAttempt) {
+	f.release(a)
+}
+
+// Removes the attempt from the pending ones, reporting whether it was pending.
+func (f *AddCardFlow) release(a *AddCardAttempt) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, p := range f.pending[a.CustomerID] {
+		if p == a {
+			f.remove(a.CustomerID, i)
+			return true
+		}
+	}
+	return false
+}
+
+// Handles wallet callbacks sent to the callback url.
+func (f *AddCardFlow) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cb, err := f.client.GetWalletCallbackFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.HandleCallback(cb)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Removes and returns the pending attempt matching the callback, the caller holds the lock.
+func (f *AddCardFlow) take(customerID, optionID string) *AddCardAttempt {
+	attempts := f.pending[customerID]
+	if len(attempts) == 0 {
+		return nil
+	}
+	for i, a := range attempts {
+		if optionID != "" && a.OptionID == optionID {
+			f.remove(customerID, i)
+			return a
+		}
+	}
+	for i, a := range attempts {
+		if a.OptionID == "" || optionID == "" {
+			f.remove(customerID, i)
+			return a
+		}
+	}
+	return nil
+}
+
+func (f *AddCardFlow) remove(customerID string, i int) {
+	attempts := append(f.pending[customerID][:i:i], f.pending[customerID][i+1:]...)
+	if len(attempts) == 0 {
+		delete(f.pending, customerID)
+		return
+	}
+	f.pending[customerID] = attempts
+}
@@ -0,0 +1,161 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+	"github.com/kabachoksolutions/rozetkapay/rozetkapaytest"
+)
+
+func cardSchema(token string) *rozetkapay.AddWalletCustomerSchema {
+	return &rozetkapay.AddWalletCustomerSchema{
+		PaymentMethod: rozetkapay.PaymentMethod{
+			Type:    rozetkapay.PaymentMethodTypeCCToken,
+			CCToken: rozetkapay.CCToken{Token: token},
+		},
+	}
+}
+
+func waitCard(t *testing.T, a *rozetkapay.AddCardAttempt) (rozetkapay.WalletEntry, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entry, err := a.Wait(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("attempt not resolved")
+	}
+	return entry, err
+}
+
+func TestAddCardSavedAtOnce(t *testing.T) {
+	_, c := newFakeClient(t)
+	flow := rozetkapay.NewAddCardFlow(c)
+
+	a, err := flow.Start("customer-1", cardSchema("tok_visa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := a.Result()
+	if err != nil || entry.OptionID == "" || entry.OptionID != a.OptionID {
+		t.Fatalf("result %+v, %v", entry, err)
+	}
+	if found, err := flow.Check(a); !found || err != nil {
+		t.Fatalf("Check = %v, %v", found, err)
+	}
+}
+
+func TestAddCardResolvedByCallback(t *testing.T) {
+	srv, c := newFakeClient(t)
+	flow := rozetkapay.NewAddCardFlow(c)
+	receiver := httptest.NewServer(flow)
+	defer receiver.Close()
+	srv.CallbackURL = receiver.URL
+
+	a, err := flow.Start("customer-1", cardSchema(rozetkapaytest.Token3DSRequired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.ActionRequired || a.Action.Value == "" {
+		t.Fatalf("attempt %+v does not require verification", a)
+	}
+	if _, err := a.Result(); !errors.Is(err, rozetkapay.ErrAddCardPending) {
+		t.Fatalf("result before verification = %v", err)
+	}
+	srv.CompleteCardVerification(a.OptionID, "")
+	if entry, err := waitCard(t, a); err != nil || entry.OptionID != a.OptionID {
+		t.Fatalf("result %+v, %v", entry, err)
+	}
+}
+
+func TestAddCardCallbackBeforeResponse(t *testing.T) {
+	var flow *rozetkapay.AddCardFlow
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := rozetkapay.AddWalletCustomerPaymentMethod{OptionID: "opt-1", Type: "cc_token"}
+		// The callback is handled while the request is still in flight.
+		flow.HandleCallback(&rozetkapay.WalletCallback{
+			ExternalID:    "customer-1",
+			PaymentMethod: method,
+			Status:        rozetkapay.PaymentStatusSuccess,
+		})
+		json.NewEncoder(w).Encode(rozetkapay.AddWalletCustomerResponse{
+			PaymentMethod:  method,
+			Status:         rozetkapay.PaymentStatusPending,
+			ActionRequired: true,
+			Action:         rozetkapay.PaymentUserAction{Type: "url", Value: "https://checkout.example"},
+		})
+	}))
+	defer gateway.Close()
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	flow = rozetkapay.NewAddCardFlow(rozetkapay.NewClient(cfg))
+
+	a, err := flow.Start("customer-1", cardSchema("tok_visa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := waitCard(t, a); err != nil || entry.OptionID != "opt-1" {
+		t.Fatalf("result %+v, %v", entry, err)
+	}
+}
+
+func TestAddCardStartErrorLeavesNothingPending(t *testing.T) {
+	srv, c := newFakeClient(t)
+	srv.AddScenarios(rozetkapaytest.Scenario{Token: "tok_broken", HTTPStatus: http.StatusInternalServerError})
+	flow := rozetkapay.NewAddCardFlow(c)
+
+	if _, err := flow.Start("customer-1", cardSchema("tok_broken")); err == nil {
+		t.Fatal("Start succeeded")
+	}
+	if flow.HandleCallback(&rozetkapay.WalletCallback{ExternalID: "customer-1", Status: rozetkapay.PaymentStatusSuccess}) {
+		t.Fatal("callback matched the failed attempt")
+	}
+}
+
+func TestAddCardCheckDeclined(t *testing.T) {
+	srv, c := newFakeClient(t)
+	flow := rozetkapay.NewAddCardFlow(c)
+	receiver := httptest.NewServer(flow)
+	defer receiver.Close()
+	srv.CallbackURL = receiver.URL
+
+	a, err := flow.Start("customer-1", cardSchema(rozetkapaytest.Token3DSRequired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.CompleteCardVerification(a.OptionID, rozetkapay.StatusCodeTransactionDeclined)
+	waitCard(t, a)
+
+	found, err := flow.Check(a)
+	var addErr *rozetkapay.AddCardError
+	if found || !errors.As(err, &addErr) || addErr.StatusCode != rozetkapay.StatusCodeTransactionDeclined {
+		t.Fatalf("Check = %v, %v", found, err)
+	}
+}
+
+func TestAddCardCheckAfterLostCallback(t *testing.T) {
+	srv, c := newFakeClient(t)
+	flow := rozetkapay.NewAddCardFlow(c)
+
+	a, err := flow.Start("customer-1", cardSchema(rozetkapaytest.Token3DSRequired))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := flow.Check(a); found || err != nil {
+		t.Fatalf("Check before verification = %v, %v", found, err)
+	}
+	// No callback url is set, the verification callback is lost.
+	srv.CompleteCardVerification(a.OptionID, "")
+	if found, err := flow.Check(a); !found || err != nil {
+		t.Fatalf("Check = %v, %v", found, err)
+	}
+	if entry, err := a.Result(); err != nil || entry.OptionID != a.OptionID {
+		t.Fatalf("result %+v, %v", entry, err)
+	}
+}
@@ -0,0 +1,457 @@
+package rozetkapay
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type BatchAction string
+
+const (
+	BatchActionRefund BatchAction = "refund"
+	BatchActionCancel BatchAction = "cancel"
+)
+
+type BatchStatus string
+
+const (
+	// The operation was performed.
+	BatchStatusDone BatchStatus = "done"
+
+	// The line failed validation against the payment balances and was not sent.
+	BatchStatusInvalid BatchStatus = "invalid"
+
+	// The gateway rejected the operation or it could not be sent.
+	BatchStatusFailed BatchStatus = "failed"
+
+	// The line was already processed according to the journal.
+	BatchStatusSkipped BatchStatus = "skipped"
+)
+
+// BatchItem is a line of the batch CSV: external_id,amount,currency,reason.
+// A zero amount refunds or cancels the whole remaining balance.
+type BatchItem struct {
+	Line       int
+	ExternalID string
+	Amount     Money
+	Reason     string
+}
+
+type BatchResult struct {
+	Item          BatchItem
+	Status        BatchStatus
+	TransactionID string
+	Error         string
+}
+
+// Reads batch items from CSV, the header line is optional.
+func ReadBatchCSV(r io.Reader) ([]BatchItem, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var items []BatchItem
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(rec[0], "external_id") {
+			continue
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: expected external_id,amount,currency[,reason]", line)
+		}
+		amount, err := ParseMoney(rec[1], strings.ToUpper(rec[2]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		item := BatchItem{Line: line, ExternalID: rec[0], Amount: amount}
+		if len(rec) > 3 {
+			item.Reason = rec[3]
+		}
+		if item.ExternalID == "" {
+			return nil, fmt.Errorf("line %d: external_id is empty", line)
+		}
+		items = append(items, item)
+	}
+}
+
+// Writes results as CSV with a header line.
+func WriteBatchResultsCSV(w io.Writer, results []BatchResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"line", "external_id", "amount", "currency", "reason", "status", "transaction_id", "error",
+	}); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := cw.Write([]string{
+			strconv.Itoa(r.Item.Line),
+			r.Item.ExternalID,
+			r.Item.Amount.Decimal(),
+			r.Item.Amount.Currency,
+			r.Item.Reason,
+			string(r.Status),
+			r.TransactionID,
+			r.Error,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type BatchOptions struct {
+	// Number of lines processed at once, 1 if not set.
+	Concurrency int
+
+	// Limits the rate lines are processed at, in addition to any limiter of the client.
+	Limiter *RateLimiter
+
+	// File the progress is appended to. Lines recorded there as done or invalid
+	// are skipped when the batch is run again.
+	JournalPath string
+}
+
+// BatchRunner refunds or cancels payments listed in a batch.
+type BatchRunner struct {
+	client *Client
+	action BatchAction
+	opts   BatchOptions
+}
+
+func NewBatchRunner(client *Client, action BatchAction, opts BatchOptions) *BatchRunner {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &BatchRunner{client: client, action: action, opts: opts}
+}
+
+// Journal status of a line sent to the gateway whose outcome is not recorded yet.
+const batchStatusStarted BatchStatus = "started"
+
+type batchJournalEntry struct {
+	Line          int         `json:"line"`
+	ExternalID    string      `json:"external_id"`
+	Status        BatchStatus `json:"status"`
+	TransactionID string      `json:"transaction_id,omitempty"`
+	Error         string      `json:"error,omitempty"`
+
+	// Amount sent and the number of operations of the payment with the same amount and payload
+	// before it was sent, to find out on resume whether the gateway performed a line with a lost outcome.
+	Amount    string `json:"amount,omitempty"`
+	Performed int    `json:"performed,omitempty"`
+}
+
+// Processes the items and returns their results in the input order.
+// Every line is journaled before it is sent. Lines started or failed in an earlier run
+// are checked against the payment before they are sent again.
+// Lines not started before the context is done are reported as failed.
+func (r *BatchRunner) Run(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	if r.action != BatchActionRefund && r.action != BatchActionCancel {
+		return nil, fmt.Errorf("unknown batch action %q", r.action)
+	}
+
+	journaled := map[string]batchJournalEntry{}
+	var journal *batchJournal
+	if r.opts.JournalPath != "" {
+		var err error
+		if journaled, err = readBatchJournal(r.opts.JournalPath); err != nil {
+			return nil, err
+		}
+		if journal, err = openBatchJournal(r.opts.JournalPath); err != nil {
+			return nil, err
+		}
+		defer journal.Close()
+	}
+
+	type batchJob struct {
+		i    int
+		item BatchItem
+		prev *batchJournalEntry
+	}
+	results := make([]BatchResult, len(items))
+	jobs := make(chan batchJob)
+	var wg sync.WaitGroup
+	for w := 0; w < r.opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results[job.i] = r.process(ctx, job.item, job.prev, journal)
+			}
+		}()
+	}
+
+	for i, item := range items {
+		entry, ok := journaled[batchJournalKey(item.Line, item.ExternalID)]
+		if ok && (entry.Status == BatchStatusDone || entry.Status == BatchStatusInvalid) {
+			results[i] = BatchResult{
+				Item:          item,
+				Status:        BatchStatusSkipped,
+				TransactionID: entry.TransactionID,
+				Error:         entry.Error,
+			}
+			continue
+		}
+		job := batchJob{i: i, item: item}
+		if ok {
+			job.prev = &entry
+		}
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, journal.Err()
+}
+
+func (r *BatchRunner) process(ctx context.Context, item BatchItem, prev *batchJournalEntry, journal *batchJournal) BatchResult {
+	res := BatchResult{Item: item, Status: BatchStatusFailed}
+	entry := batchJournalEntry{Line: item.Line, ExternalID: item.ExternalID}
+	defer func() {
+		if res.Status != BatchStatusFailed || entry.Amount != "" {
+			entry.Status, entry.TransactionID, entry.Error = res.Status, res.TransactionID, res.Error
+			journal.Write(entry)
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if r.opts.Limiter != nil {
+		if err := r.opts.Limiter.Wait(ctx, OperationClassMutation); err != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+
+	info, err := Do(ctx, r.client, PaymentInfoEndpoint, item.ExternalID)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	// The line may have been performed by the gateway in an earlier run even though its outcome was lost.
+	if prev != nil && prev.Amount != "" {
+		amount, err := ParseMoney(prev.Amount, info.Currency)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		entry.Amount, entry.Performed = prev.Amount, prev.Performed
+		if n, txID := r.performed(info, amount, item.Reason); n > prev.Performed {
+			res.Status, res.TransactionID = BatchStatusDone, txID
+			return res
+		}
+	}
+
+	amount, err := r.validate(item, info)
+	if err != nil {
+		res.Status = BatchStatusInvalid
+		res.Error = err.Error()
+		return res
+	}
+
+	entry.Amount = amount.Decimal()
+	entry.Performed, _ = r.performed(info, amount, item.Reason)
+	entry.Status = batchStatusStarted
+	if err := journal.Write(entry); err != nil {
+		// Not sent, so there is nothing to check on resume.
+		entry.Amount = ""
+		res.Error = err.Error()
+		return res
+	}
+
+	var resp *PaymentResponse
+	switch r.action {
+	case BatchActionRefund:
+		resp, err = Do(ctx, r.client, RefundPaymentEndpoint, &RefundPaymentSchema{
+			ExternalID:  item.ExternalID,
+			Amount:      amount.Float64(),
+			Currency:    amount.Currency,
+			CallbackURL: r.client.c.CallbackURL,
+			Payload:     item.Reason,
+		})
+	case BatchActionCancel:
+		resp, err = Do(ctx, r.client, CancelPaymentEndpoint, &CancelPaymentSchema{
+			ExternalID:  item.ExternalID,
+			Amount:      amount.Float64(),
+			Currency:    amount.Currency,
+			CallbackURL: r.client.c.CallbackURL,
+			Payload:     item.Reason,
+		})
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.TransactionID = resp.Details.TransactionID
+	if resp.Details.Status == PaymentStatusFailure {
+		res.Error = string(resp.Details.StatusCode)
+		return res
+	}
+	res.Status = BatchStatusDone
+	return res
+}
+
+// Counts the refunds or cancellations of the payment with the amount and payload
+// that did not fail, and returns the transaction id of the last of them.
+func (r *BatchRunner) performed(info *PaymentInfoResponse, amount Money, payload string) (int, string) {
+	var details []PurchaseDetail
+	switch r.action {
+	case BatchActionRefund:
+		for _, d := range info.RefundDetails {
+			details = append(details, PurchaseDetail(d))
+		}
+	case BatchActionCancel:
+		for _, d := range info.CancellationDetails {
+			details = append(details, PurchaseDetail(d))
+		}
+	}
+	var n int
+	var txID string
+	for _, d := range details {
+		m, err := ParseMoney(d.Amount, info.Currency)
+		if err != nil || m.Amount != amount.Amount || d.Payload != payload || PaymentStatus(d.Status) == PaymentStatusFailure {
+			continue
+		}
+		n++
+		txID = d.TransactionID
+	}
+	return n, txID
+}
+
+// Checks the item against the remaining balance of the payment
+// and returns the amount to refund or cancel.
+func (r *BatchRunner) validate(item BatchItem, info *PaymentInfoResponse) (Money, error) {
+	if item.Amount.Currency != "" && !strings.EqualFold(item.Amount.Currency, info.Currency) {
+		return Money{}, fmt.Errorf("currency %s does not match payment currency %s", item.Amount.Currency, info.Currency)
+	}
+
+	var available Money
+	balances := []string{info.Amount, info.AmountConfirmed, info.AmountCanceled, info.AmountRefunded}
+	parsed := make([]Money, len(balances))
+	for i, b := range balances {
+		m, err := ParseMoney(b, info.Currency)
+		if err != nil {
+			return Money{}, err
+		}
+		parsed[i] = m
+	}
+	total, confirmed, canceled, refunded := parsed[0], parsed[1], parsed[2], parsed[3]
+
+	switch r.action {
+	case BatchActionRefund:
+		available = confirmed.Sub(refunded)
+	case BatchActionCancel:
+		if !confirmed.IsZero() {
+			return Money{}, errors.New("payment is already confirmed, refund it instead")
+		}
+		available = total.Sub(canceled)
+	}
+	if available.Amount <= 0 {
+		return Money{}, fmt.Errorf("nothing left to %s", r.action)
+	}
+
+	amount := Money{Amount: item.Amount.Amount, Currency: info.Currency}
+	if amount.IsZero() {
+		amount = available
+	}
+	if amount.Amount < 0 || amount.Amount > available.Amount {
+		return Money{}, fmt.Errorf("amount %s exceeds available %s", amount, available)
+	}
+	return amount, nil
+}
+
+func batchJournalKey(line int, externalID string) string {
+	return strconv.Itoa(line) + ":" + externalID
+}
+
+// batchJournal appends entries to the journal file, keeping the first write error.
+// A nil journal discards entries.
+type batchJournal struct {
+	mu  sync.Mutex
+	f   *os.File
+	err error
+}
+
+func openBatchJournal(path string) (*batchJournal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &batchJournal{f: f}, nil
+}
+
+// Appends the entry and syncs the file.
+func (j *batchJournal) Write(entry batchJournalEntry) error {
+	if j == nil {
+		return nil
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err = j.f.Write(append(b, '\n')); err == nil {
+		err = j.f.Sync()
+	}
+	if err != nil && j.err == nil {
+		j.err = err
+	}
+	return err
+}
+
+func (j *batchJournal) Err() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *batchJournal) Close() error {
+	return j.f.Close()
+}
+
+// Returns the last journal entry of every line.
+func readBatchJournal(path string) (map[string]batchJournalEntry, error) {
+	done := map[string]batchJournalEntry{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var entry batchJournalEntry
+		// A torn last line from a crash is ignored, its item is processed again.
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			continue
+		}
+		done[batchJournalKey(entry.Line, entry.ExternalID)] = entry
+	}
+	return done, sc.Err()
+}
@@ -0,0 +1,256 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func writeJournal(t *testing.T, entries ...map[string]interface{}) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	var b strings.Builder
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadBatchCSV(t *testing.T) {
+	items, err := rozetkapay.ReadBatchCSV(strings.NewReader("external_id,amount,currency,reason\norder-1,40.50,uah,damaged\norder-2,0,UAH\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("read %d items", len(items))
+	}
+	if items[0].Line != 2 || items[0].Amount.Amount != 4050 || items[0].Amount.Currency != "UAH" || items[0].Reason != "damaged" {
+		t.Fatalf("unexpected first item %+v", items[0])
+	}
+	if !items[1].Amount.IsZero() {
+		t.Fatalf("unexpected second item %+v", items[1])
+	}
+
+	for _, in := range []string{"order-1,40\n", "order-1,4.005,UAH\n", ",1,UAH\n"} {
+		if _, err := rozetkapay.ReadBatchCSV(strings.NewReader(in)); err == nil {
+			t.Errorf("ReadBatchCSV(%q) accepted invalid input", in)
+		}
+	}
+}
+
+func TestBatchResumeSkipsDoneLines(t *testing.T) {
+	srv, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+	createDirectPayment(t, c, "order-2", 100, "tok_visa")
+
+	items, err := rozetkapay.ReadBatchCSV(strings.NewReader("order-1,40,UAH\norder-2,0,UAH\norder-3,10,UAH\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := filepath.Join(t.TempDir(), "journal.jsonl")
+	runner := rozetkapay.NewBatchRunner(c, rozetkapay.BatchActionRefund, rozetkapay.BatchOptions{Concurrency: 2, JournalPath: journal})
+
+	results, err := runner.Run(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rozetkapay.BatchStatus{rozetkapay.BatchStatusDone, rozetkapay.BatchStatusDone, rozetkapay.BatchStatusFailed}
+	for i, r := range results {
+		if r.Status != want[i] {
+			t.Fatalf("line %d status %s (%s), want %s", r.Item.Line, r.Status, r.Error, want[i])
+		}
+	}
+
+	results, err = runner.Run(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != rozetkapay.BatchStatusSkipped || results[1].Status != rozetkapay.BatchStatusSkipped {
+		t.Fatalf("done lines not skipped: %s, %s", results[0].Status, results[1].Status)
+	}
+	info, _ := srv.Payment("order-2")
+	if info.AmountRefunded != "100.00" || len(info.RefundDetails) != 1 {
+		t.Fatalf("order-2 refunded %s in %d refunds", info.AmountRefunded, len(info.RefundDetails))
+	}
+}
+
+func TestBatchResumeFindsLineWithLostOutcome(t *testing.T) {
+	srv, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+
+	// The refund reached the gateway, but the run stopped before journaling the outcome.
+	if _, err := c.RefundPayment(&rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 40, Currency: "UAH", Payload: "damaged"}); err != nil {
+		t.Fatal(err)
+	}
+	journal := writeJournal(t, map[string]interface{}{
+		"line": 1, "external_id": "order-1", "status": "started", "amount": "40.00", "performed": 0,
+	})
+
+	items := []rozetkapay.BatchItem{{Line: 1, ExternalID: "order-1", Amount: rozetkapay.Money{Amount: 4000, Currency: "UAH"}, Reason: "damaged"}}
+	results, err := rozetkapay.NewBatchRunner(c, rozetkapay.BatchActionRefund, rozetkapay.BatchOptions{JournalPath: journal}).Run(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != rozetkapay.BatchStatusDone || results[0].TransactionID == "" {
+		t.Fatalf("line status %s, transaction %q", results[0].Status, results[0].TransactionID)
+	}
+	info, _ := srv.Payment("order-1")
+	if info.AmountRefunded != "40.00" || len(info.RefundDetails) != 1 {
+		t.Fatalf("refunded %s in %d refunds, want 40.00 in 1", info.AmountRefunded, len(info.RefundDetails))
+	}
+}
+
+func TestBatchResumeResendsLineNotPerformed(t *testing.T) {
+	srv, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+
+	// An earlier refund with the same amount and reason is counted as performed before the line.
+	if _, err := c.RefundPayment(&rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 40, Currency: "UAH", Payload: "damaged"}); err != nil {
+		t.Fatal(err)
+	}
+	journal := writeJournal(t, map[string]interface{}{
+		"line": 1, "external_id": "order-1", "status": "failed", "amount": "40.00", "performed": 1, "error": "timeout",
+	})
+
+	items := []rozetkapay.BatchItem{{Line: 1, ExternalID: "order-1", Amount: rozetkapay.Money{Amount: 4000, Currency: "UAH"}, Reason: "damaged"}}
+	results, err := rozetkapay.NewBatchRunner(c, rozetkapay.BatchActionRefund, rozetkapay.BatchOptions{JournalPath: journal}).Run(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != rozetkapay.BatchStatusDone {
+		t.Fatalf("line status %s: %s", results[0].Status, results[0].Error)
+	}
+	info, _ := srv.Payment("order-1")
+	if info.AmountRefunded != "80.00" || len(info.RefundDetails) != 2 {
+		t.Fatalf("refunded %s in %d refunds, want 80.00 in 2", info.AmountRefunded, len(info.RefundDetails))
+	}
+}
+
+func TestBatchJournalsFailedLines(t *testing.T) {
+	srv, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+
+	journal := filepath.Join(t.TempDir(), "journal.jsonl")
+	items := []rozetkapay.BatchItem{{Line: 1, ExternalID: "order-1", Amount: rozetkapay.Money{Amount: 4000, Currency: "UAH"}}}
+
+	// The gateway answers the refund with an error after the line is journaled as started.
+	var refunds int
+	c2 := rozetkapay.NewClient(srv.Config(), rozetkapay.WithCustomHTTPClient(&http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(r.URL.Path, "/refund") {
+			refunds++
+			return nil, context.DeadlineExceeded
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})}))
+	results, err := rozetkapay.NewBatchRunner(c2, rozetkapay.BatchActionRefund, rozetkapay.BatchOptions{JournalPath: journal}).Run(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Status != rozetkapay.BatchStatusFailed || refunds != 1 {
+		t.Fatalf("line status %s after %d refunds", results[0].Status, refunds)
+	}
+
+	b, err := os.ReadFile(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"status":"started"`) || !strings.Contains(lines[1], `"status":"failed"`) {
+		t.Fatalf("journal:\n%s", b)
+	}
+}
+
+func TestBatchContextAbortsInFlightCalls(t *testing.T) {
+	block := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-block:
+		}
+	}))
+	defer gateway.Close()
+	defer close(block)
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	c := rozetkapay.NewClient(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	items := []rozetkapay.BatchItem{{Line: 1, ExternalID: "order-1"}, {Line: 2, ExternalID: "order-2"}}
+
+	start := time.Now()
+	results, err := rozetkapay.NewBatchRunner(c, rozetkapay.BatchActionRefund, rozetkapay.BatchOptions{}).Run(ctx, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Run returned after %s", elapsed)
+	}
+	for _, r := range results {
+		if r.Status != rozetkapay.BatchStatusFailed {
+			t.Fatalf("line %d status %s", r.Item.Line, r.Status)
+		}
+	}
+}
+
+func TestBatchConcurrencyLimit(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+	)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"transaction_not_found"}`))
+	}))
+	defer gateway.Close()
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	c := rozetkapay.NewClient(cfg)
+
+	var items []rozetkapay.BatchItem
+	for i := 1; i <= 20; i++ {
+		items = append(items, rozetkapay.BatchItem{Line: i, ExternalID: "order"})
+	}
+	if _, err := rozetkapay.NewBatchRunner(c, rozetkapay.BatchActionCancel, rozetkapay.BatchOptions{Concurrency: 3}).Run(context.Background(), items); err != nil {
+		t.Fatal(err)
+	}
+	if peak > 3 {
+		t.Fatalf("%d lines processed at once, want at most 3", peak)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
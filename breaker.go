@@ -0,0 +1,273 @@
+package rozetkapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCircuitOpen error = errors.New("circuit breaker is open")
+)
+
+type CircuitState string
+
+const (
+	// Calls pass through and their outcomes are counted.
+	CircuitStateClosed CircuitState = "closed"
+
+	// Calls fail fast with ErrCircuitOpen.
+	CircuitStateOpen CircuitState = "open"
+
+	// A limited number of probe calls pass through to check whether the gateway recovered.
+	CircuitStateHalfOpen CircuitState = "half_open"
+)
+
+type CircuitBreakerConfig struct {
+	// Length of the sliding window the failure rate is computed over.
+	Window time.Duration
+
+	// Number of buckets the window is split into.
+	Buckets int
+
+	// Minimum number of calls within the window before the failure rate is evaluated.
+	MinRequests int
+
+	// Failure rate from 0 to 1 at which the circuit opens.
+	FailureRate float64
+
+	// How long the circuit stays open before probe calls are allowed.
+	OpenTimeout time.Duration
+
+	// Number of successful probe calls required to close the circuit again.
+	HalfOpenProbes int
+
+	// Called whenever the circuit of an operation changes its state.
+	// It runs while the breaker is locked and must not call back into it.
+	OnStateChange func(op Operation, from, to CircuitState)
+}
+
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:         time.Minute,
+		Buckets:        10,
+		MinRequests:    20,
+		FailureRate:    0.5,
+		OpenTimeout:    30 * time.Second,
+		HalfOpenProbes: 3,
+	}
+}
+
+// CircuitBreaker keeps a separate circuit per operation,
+// so an outage of one endpoint does not block calls to the others.
+type CircuitBreaker struct {
+	cfg      CircuitBreakerConfig
+	now      func() time.Time
+	mu       sync.Mutex
+	circuits map[Operation]*circuit
+}
+
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	def := DefaultCircuitBreakerConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = def.Window
+	}
+	if cfg.Buckets <= 0 {
+		cfg.Buckets = def.Buckets
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = def.MinRequests
+	}
+	if cfg.FailureRate <= 0 || cfg.FailureRate > 1 {
+		cfg.FailureRate = def.FailureRate
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = def.OpenTimeout
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = def.HalfOpenProbes
+	}
+	return &CircuitBreaker{
+		cfg:      cfg,
+		now:      time.Now,
+		circuits: map[Operation]*circuit{},
+	}
+}
+
+type circuitOutcome int
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+
+	// The call did not reach the gateway or was abandoned by the caller, it tells nothing about its health.
+	circuitIgnored
+)
+
+type circuitBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+type circuit struct {
+	state    CircuitState
+	openedAt time.Time
+	buckets  []circuitBucket
+
+	// Probe calls in flight and succeeded while half-open.
+	probes    int
+	succeeded int
+}
+
+// Checks whether a call of the operation may proceed.
+// On success the returned function must be called with the outcome of the call.
+func (b *CircuitBreaker) Allow(op Operation) (done func(failed bool), err error) {
+	report, err := b.allow(op)
+	if err != nil {
+		return nil, err
+	}
+	return func(failed bool) {
+		if failed {
+			report(circuitFailure)
+		} else {
+			report(circuitSuccess)
+		}
+	}, nil
+}
+
+func (b *CircuitBreaker) allow(op Operation) (func(circuitOutcome), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(op)
+	now := b.now()
+
+	if c.state == CircuitStateOpen {
+		if now.Sub(c.openedAt) < b.cfg.OpenTimeout {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, op)
+		}
+		b.transition(op, c, CircuitStateHalfOpen)
+	}
+	if c.state == CircuitStateHalfOpen {
+		if c.probes+c.succeeded >= b.cfg.HalfOpenProbes {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, op)
+		}
+		c.probes++
+	}
+
+	state := c.state
+	return func(outcome circuitOutcome) {
+		b.record(op, state, outcome)
+	}, nil
+}
+
+// Returns the current state of the operation circuit.
+func (b *CircuitBreaker) State(op Operation) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuit(op).state
+}
+
+func (b *CircuitBreaker) circuit(op Operation) *circuit {
+	c, ok := b.circuits[op]
+	if !ok {
+		c = &circuit{
+			state:   CircuitStateClosed,
+			buckets: make([]circuitBucket, b.cfg.Buckets),
+		}
+		b.circuits[op] = c
+	}
+	return c
+}
+
+func (b *CircuitBreaker) record(op Operation, state CircuitState, outcome circuitOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(op)
+	now := b.now()
+
+	if state == CircuitStateHalfOpen {
+		if c.state != CircuitStateHalfOpen {
+			return
+		}
+		c.probes--
+		switch outcome {
+		case circuitIgnored:
+			return
+		case circuitFailure:
+			c.openedAt = now
+			b.transition(op, c, CircuitStateOpen)
+			return
+		}
+		c.succeeded++
+		if c.succeeded >= b.cfg.HalfOpenProbes {
+			b.transition(op, c, CircuitStateClosed)
+		}
+		return
+	}
+
+	if c.state != CircuitStateClosed || outcome == circuitIgnored {
+		return
+	}
+
+	width := b.cfg.Window / time.Duration(b.cfg.Buckets)
+	start := now.Truncate(width)
+	bucket := &c.buckets[int(start.UnixNano()/int64(width))%len(c.buckets)]
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	bucket.total++
+	if outcome == circuitFailure {
+		bucket.failures++
+	}
+
+	var total, failures int
+	for _, bk := range c.buckets {
+		if now.Sub(bk.start) < b.cfg.Window {
+			total += bk.total
+			failures += bk.failures
+		}
+	}
+	if total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.FailureRate {
+		c.openedAt = now
+		b.transition(op, c, CircuitStateOpen)
+	}
+}
+
+func (b *CircuitBreaker) transition(op Operation, c *circuit, to CircuitState) {
+	from := c.state
+	c.state = to
+	c.probes = 0
+	c.succeeded = 0
+	if to == CircuitStateClosed {
+		c.buckets = make([]circuitBucket, b.cfg.Buckets)
+	}
+	if b.cfg.OnStateChange != nil && from != to {
+		b.cfg.OnStateChange(op, from, to)
+	}
+}
+
+// Only transport errors, server errors and throttling indicate the gateway is unhealthy,
+// declined payments and invalid requests do not.
+func isGatewayFailure(status int, err error) bool {
+	if err == nil {
+		return false
+	}
+	return status == 0 || status >= 500 || status == 429
+}
+
+// Classifies the outcome of a call for the breaker. Calls that never reached the gateway,
+// e.g. stopped by the rate limiter, and calls abandoned by the caller's context are ignored.
+func sendOutcome(ctx context.Context, sent bool, status int, err error) circuitOutcome {
+	switch {
+	case !sent || err != nil && status == 0 && ctx.Err() != nil:
+		return circuitIgnored
+	case isGatewayFailure(status, err):
+		return circuitFailure
+	}
+	return circuitSuccess
+}
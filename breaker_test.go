@@ -0,0 +1,201 @@
+package rozetkapay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Breaker with a clock moved by the test.
+type fakeClock struct{ t time.Time }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+
+func (c *fakeClock) breaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	b := NewCircuitBreaker(cfg)
+	b.now = c.now
+	return b
+}
+
+func call(t *testing.T, b *CircuitBreaker, outcome circuitOutcome) {
+	t.Helper()
+	report, err := b.allow(OperationGetPaymentInfo)
+	if err != nil {
+		t.Fatalf("call rejected: %v", err)
+	}
+	report(outcome)
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	clock := newFakeClock()
+	b := clock.breaker(CircuitBreakerConfig{MinRequests: 4, FailureRate: 0.5, OpenTimeout: 10 * time.Second, HalfOpenProbes: 2})
+	op := OperationGetPaymentInfo
+
+	call(t, b, circuitSuccess)
+	call(t, b, circuitSuccess)
+	call(t, b, circuitFailure)
+	if b.State(op) != CircuitStateClosed {
+		t.Fatal("opened below the minimum number of requests")
+	}
+	call(t, b, circuitFailure)
+	if b.State(op) != CircuitStateOpen {
+		t.Fatalf("state %s at 50%% failures", b.State(op))
+	}
+	if _, err := b.Allow(op); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow while open = %v", err)
+	}
+	if _, err := b.Allow(OperationRefundPayment); err != nil {
+		t.Fatalf("other operation blocked: %v", err)
+	}
+
+	clock.add(10 * time.Second)
+	call(t, b, circuitSuccess)
+	if b.State(op) != CircuitStateHalfOpen {
+		t.Fatalf("state %s after the open timeout", b.State(op))
+	}
+	call(t, b, circuitSuccess)
+	if b.State(op) != CircuitStateClosed {
+		t.Fatalf("state %s after the probes succeeded", b.State(op))
+	}
+}
+
+func TestCircuitBreakerProbeFailureReopens(t *testing.T) {
+	clock := newFakeClock()
+	b := clock.breaker(CircuitBreakerConfig{MinRequests: 1, FailureRate: 1, OpenTimeout: time.Second, HalfOpenProbes: 1})
+	op := OperationGetPaymentInfo
+
+	call(t, b, circuitFailure)
+	clock.add(time.Second)
+	call(t, b, circuitFailure)
+	if b.State(op) != CircuitStateOpen {
+		t.Fatalf("state %s after a failed probe", b.State(op))
+	}
+}
+
+func TestCircuitBreakerIgnoredOutcomes(t *testing.T) {
+	clock := newFakeClock()
+	b := clock.breaker(CircuitBreakerConfig{MinRequests: 1, FailureRate: 1, OpenTimeout: time.Second, HalfOpenProbes: 1})
+	op := OperationGetPaymentInfo
+
+	call(t, b, circuitIgnored)
+	if b.State(op) != CircuitStateClosed {
+		t.Fatal("ignored call opened the circuit")
+	}
+
+	call(t, b, circuitFailure)
+	clock.add(time.Second)
+	// An ignored probe frees its slot without deciding the state.
+	call(t, b, circuitIgnored)
+	if b.State(op) != CircuitStateHalfOpen {
+		t.Fatalf("state %s after an ignored probe", b.State(op))
+	}
+	call(t, b, circuitSuccess)
+	if b.State(op) != CircuitStateClosed {
+		t.Fatalf("state %s after a successful probe", b.State(op))
+	}
+}
+
+func TestSendOutcome(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	bg := context.Background()
+	transportErr := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		sent   bool
+		status int
+		err    error
+		want   circuitOutcome
+	}{
+		{"success", bg, true, 200, nil, circuitSuccess},
+		{"declined", bg, true, 400, &ErrorResponse{Code: StatusCodeTransactionDeclined}, circuitSuccess},
+		{"server error", bg, true, 500, &ErrorResponse{Code: StatusCodeInternalError}, circuitFailure},
+		{"throttled", bg, true, 429, &ErrorResponse{}, circuitFailure},
+		{"transport error", bg, true, 0, transportErr, circuitFailure},
+		{"not sent", bg, false, 0, context.DeadlineExceeded, circuitIgnored},
+		{"caller canceled", canceled, true, 0, context.Canceled, circuitIgnored},
+	}
+	for _, tt := range tests {
+		if got := sendOutcome(tt.ctx, tt.sent, tt.status, tt.err); got != tt.want {
+			t.Errorf("%s: outcome %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientBreakerIgnoresLocalErrors(t *testing.T) {
+	block := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("external_id") == "slow" {
+			select {
+			case <-r.Context().Done():
+			case <-block:
+			}
+			return
+		}
+		w.Write([]byte(`{"id":"p1"}`))
+	}))
+	defer gateway.Close()
+	defer close(block)
+
+	cfg := NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 2, FailureRate: 0.5})
+	limiter := NewRateLimiter(RateLimit{Rate: 0.1, Burst: 1}, RateLimit{})
+	c := NewClient(cfg, WithCircuitBreaker(breaker), WithRateLimiter(limiter))
+
+	if _, err := c.GetPaymentInfo("order-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limiter has no slot before the deadline, the request is never sent.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Do(ctx, c, PaymentInfoEndpoint, "order-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("limited call error = %v", err)
+	}
+	if s := breaker.State(OperationGetPaymentInfo); s != CircuitStateClosed {
+		t.Fatalf("state %s after a call stopped by the limiter", s)
+	}
+
+	// The caller gives up while the gateway is answering.
+	c = NewClient(cfg, WithCircuitBreaker(breaker))
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Do(ctx, c, PaymentInfoEndpoint, "slow"); err == nil {
+		t.Fatal("abandoned call succeeded")
+	}
+	if s := breaker.State(OperationGetPaymentInfo); s != CircuitStateClosed {
+		t.Fatalf("state %s after a call abandoned by the caller", s)
+	}
+}
+
+func TestClientBreakerCountsServerErrors(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"code":"internal_error"}`))
+	}))
+	defer gateway.Close()
+
+	cfg := NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinRequests: 2, FailureRate: 0.5})
+	c := NewClient(cfg, WithCircuitBreaker(breaker))
+
+	for i := 0; i < 2; i++ {
+		c.GetPaymentInfo("order-1")
+	}
+	if _, err := c.GetPaymentInfo("order-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("call after server errors = %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package rozetkapay
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// CallResponse is the response of a raw call.
+type CallResponse struct {
+	StatusCode int
+	Header     http.Header
+
+	// Response body as received.
+	Raw json.RawMessage
+
+	// Value the body is decoded into, if any.
+	out interface{}
+}
+
+// Calls an endpoint the client has no method for. The path is relative to Config.API,
+// the body is encoded as JSON unless nil, use json.RawMessage to send it as is.
+// The response body is decoded into out, if not nil, and is always available as CallResponse.Raw.
+// The call goes through Send, so authorization, retries and the other client features apply.
+// Gateway errors are returned as *ErrorResponse together with the response.
+func (c *Client) Call(ctx context.Context, method, path string, query map[string]string, body, out interface{}) (
+	*CallResponse, error,
+) {
+	req, err := c.NewRequest(method, c.c.API+strings.TrimPrefix(path, "/"), body, query)
+	if err != nil {
+		return nil, err
+	}
+	resp := &CallResponse{out: out}
+	if err := c.Send(req.WithContext(ctx), resp); err != nil {
+		if resp.StatusCode == 0 {
+			return nil, err
+		}
+		return resp, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,103 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+// Gateway answering every call with the method, path, query and body it received.
+func echoGateway(t *testing.T) *rozetkapay.Client {
+	t.Helper()
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Request-Id", "req-1")
+		if r.URL.Path == "/api/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"invalid_request","message":"bad","param":"amount"}`))
+			return
+		}
+		echo := map[string]interface{}{"method": r.Method, "path": r.URL.Path, "query": r.URL.RawQuery}
+		if len(body) > 0 {
+			echo["body"] = json.RawMessage(body)
+		}
+		json.NewEncoder(w).Encode(echo)
+	}))
+	t.Cleanup(gateway.Close)
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/api/"
+	return rozetkapay.NewClient(cfg)
+}
+
+func TestCallWithoutOutReturnsRaw(t *testing.T) {
+	c := echoGateway(t)
+	resp, err := c.Call(context.Background(), http.MethodGet, "/echo", map[string]string{"id": "1"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Request-Id") != "req-1" {
+		t.Fatalf("status %d, header %v", resp.StatusCode, resp.Header)
+	}
+	var got struct{ Method, Path, Query string }
+	if err := json.Unmarshal(resp.Raw, &got); err != nil {
+		t.Fatalf("raw %q: %v", resp.Raw, err)
+	}
+	if got.Method != http.MethodGet || got.Path != "/api/echo" || got.Query != "id=1" {
+		t.Fatalf("gateway received %+v", got)
+	}
+}
+
+func TestCallDecodesIntoOut(t *testing.T) {
+	c := echoGateway(t)
+	var out struct {
+		Method string
+		Body   struct {
+			Amount int `json:"amount"`
+		}
+	}
+	resp, err := c.Call(context.Background(), http.MethodPost, "echo", nil, json.RawMessage(`{"amount":10}`), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Method != http.MethodPost || out.Body.Amount != 10 {
+		t.Fatalf("decoded %+v", out)
+	}
+	if len(resp.Raw) == 0 {
+		t.Fatal("raw body not kept when decoding")
+	}
+}
+
+func TestCallErrorKeepsResponse(t *testing.T) {
+	c := echoGateway(t)
+	var out map[string]interface{}
+	resp, err := c.Call(context.Background(), http.MethodPost, "fail", nil, map[string]int{"amount": -1}, &out)
+	var errResp *rozetkapay.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Code != "invalid_request" || errResp.HTTPStatus != http.StatusBadRequest {
+		t.Fatalf("error %v", err)
+	}
+	if resp == nil {
+		t.Fatal("no response with the gateway error")
+	}
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("X-Request-Id") != "req-1" || len(resp.Raw) == 0 {
+		t.Fatalf("status %d, header %v, raw %q", resp.StatusCode, resp.Header, resp.Raw)
+	}
+	if out != nil {
+		t.Fatalf("error response decoded into out: %v", out)
+	}
+}
+
+func TestCallTransportErrorHasNoResponse(t *testing.T) {
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = "http://127.0.0.1:1/"
+	resp, err := rozetkapay.NewClient(cfg).Call(context.Background(), http.MethodGet, "echo", nil, nil, nil)
+	if err == nil || resp != nil {
+		t.Fatalf("response %+v, error %v", resp, err)
+	}
+}
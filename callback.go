@@ -0,0 +1,160 @@
+package rozetkapay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrEmptyCallback error = errors.New("empty callback")
+)
+
+type CallbackKind string
+
+const (
+	CallbackKindPayment CallbackKind = "payment"
+	CallbackKindConfirm CallbackKind = "confirm"
+	CallbackKindCancel  CallbackKind = "cancel"
+	CallbackKindRefund  CallbackKind = "refund"
+	CallbackKindWallet  CallbackKind = "wallet"
+
+	// Payment callback without the operation, which could not be told from the ledger.
+	CallbackKindUnknown CallbackKind = "unknown"
+)
+
+// CallbackEvent is a decoded callback, one of PaymentCallbackEvent, ConfirmCallbackEvent,
+// CancelCallbackEvent, RefundCallbackEvent, UnknownCallbackEvent or WalletCallbackEvent.
+type CallbackEvent interface {
+	Kind() CallbackKind
+	callbackEvent()
+}
+
+type (
+	// Callback of the purchase, sent after the payment is created or the checkout is completed.
+	PaymentCallbackEvent struct{ *PaymentResponse }
+
+	ConfirmCallbackEvent struct{ *PaymentResponse }
+
+	CancelCallbackEvent struct{ *PaymentResponse }
+
+	RefundCallbackEvent struct{ *PaymentResponse }
+
+	// Callback of a payment operation the client could not identify.
+	UnknownCallbackEvent struct{ *PaymentResponse }
+
+	// Callback of a payment method added to the wallet.
+	WalletCallbackEvent struct{ *WalletCallback }
+)
+
+func (PaymentCallbackEvent) Kind() CallbackKind { return CallbackKindPayment }
+func (ConfirmCallbackEvent) Kind() CallbackKind { return CallbackKindConfirm }
+func (CancelCallbackEvent) Kind() CallbackKind  { return CallbackKindCancel }
+func (RefundCallbackEvent) Kind() CallbackKind  { return CallbackKindRefund }
+func (UnknownCallbackEvent) Kind() CallbackKind { return CallbackKindUnknown }
+func (WalletCallbackEvent) Kind() CallbackKind  { return CallbackKindWallet }
+
+func (PaymentCallbackEvent) callbackEvent() {}
+func (ConfirmCallbackEvent) callbackEvent() {}
+func (CancelCallbackEvent) callbackEvent()  {}
+func (RefundCallbackEvent) callbackEvent()  {}
+func (UnknownCallbackEvent) callbackEvent() {}
+func (WalletCallbackEvent) callbackEvent()  {}
+
+// Fields telling the kinds of callbacks apart.
+type callbackEnvelope struct {
+	Operation  CallbackKind    `json:"operation"`
+	ExternalID string          `json:"external_id"`
+	Details    json.RawMessage `json:"details"`
+}
+
+// Decodes the callback body into the event of its kind, wallet callbacks have no payment details.
+// The gateway does not name the operation of payment callbacks, it is taken from the operation field
+// if present, otherwise from the ledger entries of the transaction: a callback of an order without entries
+// is its purchase. Without a ledger or a matching entry the callback is an UnknownCallbackEvent.
+func (c *Client) DecodeCallback(body []byte) (CallbackEvent, error) {
+	return c.decodeCallback(context.Background(), body)
+}
+
+// Decodes the callback from the incoming request, continuing the trace propagated in its headers.
+func (c *Client) DecodeCallbackRequest(r *http.Request) (CallbackEvent, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return c.decodeCallback(c.tracer.Extract(r.Context(), r.Header), body)
+}
+
+func (c *Client) decodeCallback(ctx context.Context, body []byte) (CallbackEvent, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || bytes.Equal(body, []byte("null")) {
+		return nil, ErrEmptyCallback
+	}
+	var env callbackEnvelope
+	err := json.Unmarshal(body, &env)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(env.Details) == 0 || bytes.Equal(env.Details, []byte("null")) {
+		if env.Operation != "" && env.Operation != CallbackKindWallet {
+			return nil, fmt.Errorf("%s callback without payment details", env.Operation)
+		}
+		cb, err := c.parseWalletCallback(ctx, body)
+		if err != nil {
+			return nil, err
+		}
+		return WalletCallbackEvent{cb}, nil
+	}
+
+	var op LedgerOperation
+	switch env.Operation {
+	case "":
+		if op, err = c.callbackOperation(env); err != nil {
+			return nil, err
+		}
+	case CallbackKindPayment:
+		op = LedgerOperationCreate
+	case CallbackKindConfirm:
+		op = LedgerOperationConfirm
+	case CallbackKindCancel:
+		op = LedgerOperationCancel
+	case CallbackKindRefund:
+		op = LedgerOperationRefund
+	default:
+		return nil, fmt.Errorf("unknown callback operation %q", env.Operation)
+	}
+	resp, err := c.parsePaymentCallback(ctx, body, op)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case LedgerOperationCreate:
+		return PaymentCallbackEvent{resp}, nil
+	case LedgerOperationConfirm:
+		return ConfirmCallbackEvent{resp}, nil
+	case LedgerOperationCancel:
+		return CancelCallbackEvent{resp}, nil
+	case LedgerOperationRefund:
+		return RefundCallbackEvent{resp}, nil
+	}
+	return UnknownCallbackEvent{resp}, nil
+}
+
+// Resolves the operation of a callback without one from the ledger, unknown without a ledger.
+func (c *Client) callbackOperation(env callbackEnvelope) (LedgerOperation, error) {
+	if c.ledger == nil {
+		return LedgerOperationUnknown, nil
+	}
+	var details struct {
+		TransactionID string `json:"transaction_id"`
+	}
+	if err := json.Unmarshal(env.Details, &details); err != nil {
+		return "", err
+	}
+	return c.ledger.callbackOperation(env.ExternalID, details.TransactionID)
+}
@@ -0,0 +1,253 @@
+package rozetkapay_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+const (
+	samplePaymentCallback = `{
+		"id": "2b5c1e0a4d",
+		"action_required": false,
+		"external_id": "order-1",
+		"is_success": true,
+		"receipt_url": "https://receipt.example/2b5c1e0a4d",
+		"details": {
+			"amount": "100.00",
+			"currency": "UAH",
+			"payment_id": "2b5c1e0a4d",
+			"transaction_id": "tx-purchase",
+			"status": "success",
+			"status_code": "transaction_successful",
+			"fee": {"amount": "1.50", "currency": "UAH"}
+		}
+	}`
+
+	sampleRefundCallback = `{
+		"id": "2b5c1e0a4d",
+		"external_id": "order-1",
+		"is_success": true,
+		"details": {
+			"amount": "40.00",
+			"currency": "UAH",
+			"payment_id": "2b5c1e0a4d",
+			"transaction_id": "tx-refund",
+			"status": "success",
+			"status_code": "transaction_successful"
+		}
+	}`
+
+	sampleWalletCallback = `{
+		"external_id": "customer-1",
+		"created_at": "2024-03-01T10:00:00Z",
+		"payment_method": {
+			"type": "cc_token",
+			"option_id": "opt-1",
+			"name": "Visa",
+			"card": {"mask": "411111******1111", "expires_at": "2030-01-01T00:00:00Z"}
+		},
+		"status": "success",
+		"status_code": "transaction_successful"
+	}`
+)
+
+// Adds the operation field to a sample payment callback.
+func withOperation(t *testing.T, body, op string) string {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		t.Fatal(err)
+	}
+	fields["operation"], _ = json.Marshal(op)
+	b, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDecodeCallbackSamples(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		kind rozetkapay.CallbackKind
+		err  bool
+	}{
+		{name: "payment without operation", body: samplePaymentCallback, kind: rozetkapay.CallbackKindUnknown},
+		{name: "refund without operation", body: sampleRefundCallback, kind: rozetkapay.CallbackKindUnknown},
+		{name: "payment operation", body: withOperation(t, samplePaymentCallback, "payment"), kind: rozetkapay.CallbackKindPayment},
+		{name: "confirm operation", body: withOperation(t, samplePaymentCallback, "confirm"), kind: rozetkapay.CallbackKindConfirm},
+		{name: "cancel operation", body: withOperation(t, sampleRefundCallback, "cancel"), kind: rozetkapay.CallbackKindCancel},
+		{name: "refund operation", body: withOperation(t, sampleRefundCallback, "refund"), kind: rozetkapay.CallbackKindRefund},
+		{name: "wallet", body: sampleWalletCallback, kind: rozetkapay.CallbackKindWallet},
+		{name: "wallet operation", body: withOperation(t, sampleWalletCallback, "wallet"), kind: rozetkapay.CallbackKindWallet},
+		{name: "unknown operation", body: withOperation(t, samplePaymentCallback, "chargeback"), err: true},
+		{name: "refund without details", body: withOperation(t, sampleWalletCallback, "refund"), err: true},
+		{name: "invalid json", body: `{"details":`, err: true},
+	}
+
+	c := rozetkapay.NewClient(rozetkapay.NewDevelopmentConfig())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := c.DecodeCallback([]byte(tt.body))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %T", ev)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.Kind() != tt.kind {
+				t.Fatalf("kind = %s, want %s", ev.Kind(), tt.kind)
+			}
+		})
+	}
+}
+
+func TestDecodeCallbackEmpty(t *testing.T) {
+	c := rozetkapay.NewClient(rozetkapay.NewDevelopmentConfig())
+	for _, body := range []string{"", "  ", "null"} {
+		if _, err := c.DecodeCallback([]byte(body)); !errors.Is(err, rozetkapay.ErrEmptyCallback) {
+			t.Errorf("DecodeCallback(%q) error = %v, want ErrEmptyCallback", body, err)
+		}
+	}
+}
+
+func TestDecodeCallbackEventFields(t *testing.T) {
+	c := rozetkapay.NewClient(rozetkapay.NewDevelopmentConfig())
+
+	ev, err := c.DecodeCallback([]byte(withOperation(t, samplePaymentCallback, "payment")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment, ok := ev.(rozetkapay.PaymentCallbackEvent)
+	if !ok {
+		t.Fatalf("event is %T", ev)
+	}
+	if payment.ExternalID != "order-1" || payment.Details.TransactionID != "tx-purchase" || payment.Details.Fee.Amount != "1.50" {
+		t.Fatalf("unexpected payment callback %+v", payment.PaymentResponse)
+	}
+
+	ev, err = c.DecodeCallback([]byte(sampleWalletCallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, ok := ev.(rozetkapay.WalletCallbackEvent)
+	if !ok {
+		t.Fatalf("event is %T", ev)
+	}
+	if wallet.ExternalID != "customer-1" || wallet.PaymentMethod.OptionID != "opt-1" {
+		t.Fatalf("unexpected wallet callback %+v", wallet.WalletCallback)
+	}
+}
+
+func TestDecodeCallbackOperationFromLedger(t *testing.T) {
+	ledger := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	_, c := newFakeClient(t, rozetkapay.WithLedger(ledger))
+
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+	refund := refundPayment(t, c, "order-1", 40)
+
+	// The gateway sends the refund callback without the operation field.
+	body, err := json.Marshal(refund)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := c.DecodeCallback(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Kind() != rozetkapay.CallbackKindRefund {
+		t.Fatalf("kind = %s, want refund", ev.Kind())
+	}
+
+	balance, err := ledger.Balance("order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Decimal() != "60.00" {
+		t.Fatalf("balance = %s, want 60.00", balance.Decimal())
+	}
+}
+
+func TestDecodeCallbackNewOrderIsPurchase(t *testing.T) {
+	ledger := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	// Sandbox payments are not recorded, so the client uses live-looking credentials.
+	c := rozetkapay.NewClient(rozetkapay.NewConfig("merchant", "secret"), rozetkapay.WithLedger(ledger))
+
+	ev, err := c.DecodeCallback([]byte(samplePaymentCallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Kind() != rozetkapay.CallbackKindPayment {
+		t.Fatalf("kind = %s, want payment", ev.Kind())
+	}
+
+	// A later transaction of the order not known to the ledger is not booked as a purchase.
+	ev, err = c.DecodeCallback([]byte(sampleRefundCallback))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Kind() != rozetkapay.CallbackKindUnknown {
+		t.Fatalf("kind = %s, want unknown", ev.Kind())
+	}
+	balance, err := ledger.Balance("order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Decimal() != "100.00" {
+		t.Fatalf("balance = %s, want 100.00", balance.Decimal())
+	}
+}
+
+func TestFakeCallbacksKeepLedgerBalance(t *testing.T) {
+	ledger := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	srv, c := newFakeClient(t, rozetkapay.WithLedger(ledger))
+
+	var (
+		mu    sync.Mutex
+		kinds []rozetkapay.CallbackKind
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev, err := c.DecodeCallbackRequest(r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		kinds = append(kinds, ev.Kind())
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+	srv.CallbackURL = receiver.URL
+
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+	refundPayment(t, c, "order-1", 40)
+	srv.WaitCallbacks()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(kinds) == 0 {
+		t.Fatal("no callbacks received")
+	}
+	for _, k := range kinds {
+		if k == rozetkapay.CallbackKindWallet {
+			t.Fatalf("payment callback decoded as %s", k)
+		}
+	}
+	balance, err := ledger.Balance("order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Decimal() != "60.00" {
+		t.Fatalf("balance = %s, want 60.00", balance.Decimal())
+	}
+}
@@ -1,26 +1,44 @@
-package main
+package rozetkapay
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"sync/atomic"
+	"time"
 )
 
 type Client struct {
 	c          *Config
 	httpClient *http.Client
+	transport  TransportConfig
+	metrics    MetricsRecorder
+	tracer     Tracer
+	breaker    *CircuitBreaker
+	limiter    *RateLimiter
+	ledger     *Ledger
+	strict     bool
+
+	// Basic auth string, replaced by SetCredentials.
+	auth atomic.Value
 }
 
 func NewClient(config *Config, opts ...ClientOpts) *Client {
 	m := &Client{
-		c:          config,
-		httpClient: http.DefaultClient,
+		c:         config,
+		transport: config.Transport,
+		tracer:    NoopTracer{},
 	}
+	m.auth.Store(config.BasicAuth)
 	for _, opt := range opts {
 		opt(m)
 	}
+	if m.httpClient == nil {
+		m.httpClient = newHTTPClient(m.transport)
+	}
 	return m
 }
 
@@ -32,11 +50,198 @@ func WithCustomHTTPClient(c *http.Client) ClientOpts {
 	}
 }
 
+// Overrides the transport settings of the config.
+// Has no effect together with WithCustomHTTPClient.
+func WithTransportConfig(t TransportConfig) ClientOpts {
+	return func(m *Client) {
+		m.transport = t
+	}
+}
+
+// Records latency and outcome of every gateway call attempt.
+func WithMetricsRecorder(r MetricsRecorder) ClientOpts {
+	return func(m *Client) {
+		m.metrics = r
+	}
+}
+
+// Wraps every gateway call and callback handling into a span.
+func WithTracer(t Tracer) ClientOpts {
+	return func(m *Client) {
+		m.tracer = t
+	}
+}
+
+// Fails calls fast with ErrCircuitOpen while the gateway is unhealthy.
+func WithCircuitBreaker(b *CircuitBreaker) ClientOpts {
+	return func(m *Client) {
+		m.breaker = b
+	}
+}
+
+// Limits the rate of outgoing requests and repeats requests throttled by the gateway.
+func WithRateLimiter(l *RateLimiter) ClientOpts {
+	return func(m *Client) {
+		m.limiter = l
+	}
+}
+
+// Records payment operations and callbacks in the ledger.
+func WithLedger(l *Ledger) ClientOpts {
+	return func(m *Client) {
+		m.ledger = l
+	}
+}
+
+// Replaces the credentials used by later calls, e.g. from WatchCredentials.
+func (c *Client) SetCredentials(creds Credentials) {
+	c.auth.Store(creds.basicAuth())
+}
+
 func (c *Client) Send(req *http.Request, v interface{}) error {
+	op := requestOperation(c.c.API, req)
+
+	ctx, span := c.tracer.Start(req.Context(), "rozetkapay."+string(op))
+	defer span.End()
+	span.SetAttribute(SpanAttributeOperation, string(op))
+	if externalID := requestExternalID(req); externalID != "" {
+		span.SetAttribute(SpanAttributeExternalID, externalID)
+	}
+
+	if err := c.checkEnvironment(op); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	var done func(circuitOutcome)
+	if c.breaker != nil {
+		var err error
+		if done, err = c.breaker.allow(op); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+
+	req = req.WithContext(ctx)
 	req.Header = http.Header{
 		"Content-type":  {"application/json"},
-		"Authorization": {"Basic " + c.c.BasicAuth},
+		"Authorization": {"Basic " + c.auth.Load().(string)},
 	}
+	c.tracer.Inject(ctx, req.Header)
+
+	class := requestClass(req)
+	var (
+		res  sendResult
+		err  error
+		sent bool
+	)
+	for attempt := 1; ; attempt++ {
+		if c.limiter != nil {
+			if err = c.limiter.Wait(ctx, class); err != nil {
+				break
+			}
+		}
+
+		start := time.Now()
+		sent = true
+		res, err = c.send(req, v)
+		if c.metrics != nil {
+			c.metrics.ObserveRequest(RequestMetrics{
+				Operation:  op,
+				Outcome:    requestOutcome(res.status, err),
+				HTTPStatus: res.status,
+				StatusCode: res.code,
+				Attempt:    attempt,
+				Duration:   time.Since(start),
+				Err:        err,
+			})
+		}
+
+		if !c.shouldRetryThrottled(req, res, err, attempt) {
+			break
+		}
+		wait := res.retryAfter
+		if wait <= 0 {
+			wait = time.Duration(attempt) * time.Second
+		}
+		c.limiter.Pause(class, time.Now().Add(wait))
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				break
+			}
+		}
+	}
+	if done != nil {
+		done(sendOutcome(ctx, sent, res.status, err))
+	}
+	if err == nil {
+		c.recordLedger(op, v)
+	}
+
+	if res.status != 0 {
+		span.SetAttribute(SpanAttributeHTTPStatus, res.status)
+	}
+	if res.paymentID != "" {
+		span.SetAttribute(SpanAttributePaymentID, res.paymentID)
+	}
+	if err != nil {
+		if res.code != "" {
+			span.SetAttribute(SpanAttributeErrorCode, string(res.code))
+		}
+		span.RecordError(err)
+	}
+	return err
+}
+
+var ledgerOperations = map[Operation]LedgerOperation{
+	OperationCreatePayment:  LedgerOperationCreate,
+	OperationConfirmPayment: LedgerOperationConfirm,
+	OperationCancelPayment:  LedgerOperationCancel,
+	OperationRefundPayment:  LedgerOperationRefund,
+}
+
+// Failing to record does not fail the payment operation, it is only logged.
+func (c *Client) recordLedger(op Operation, v interface{}) {
+	if call, ok := v.(*CallResponse); ok {
+		v = call.out
+	}
+	ledgerOp, ok := ledgerOperations[op]
+	resp, isPayment := v.(*PaymentResponse)
+	if c.ledger == nil || !ok || !isPayment || c.isTestPayment(resp) {
+		return
+	}
+	if err := c.ledger.recordPayment(LedgerSourceClient, ledgerOp, resp); err != nil {
+		log.Printf("[RozetkaPay] Error --- type: %s, external_id: %s, message: %s\n", "ledger", resp.ExternalID, err)
+	}
+}
+
+// Summary of a gateway response used by metrics and tracing.
+type sendResult struct {
+	// HTTP status, zero if no response was received.
+	status int
+
+	// Status code from the error response or from the payment details of a successful one.
+	code      PaymentStatusCode
+	paymentID string
+
+	// Delay requested by the gateway in the Retry-After header.
+	retryAfter time.Duration
+}
+
+// Throttled requests are repeated only when a rate limiter is configured
+// and the request body can be sent again.
+func (c *Client) shouldRetryThrottled(req *http.Request, res sendResult, err error, attempt int) bool {
+	if err == nil || c.limiter == nil || attempt > c.limiter.MaxRetries {
+		return false
+	}
+	if res.status != http.StatusTooManyRequests && res.code != StatusCodeReachedTheLimitOfAttemptsForIP {
+		return false
+	}
+	return req.Body == nil || req.GetBody != nil
+}
+
+func (c *Client) send(req *http.Request, v interface{}) (sendResult, error) {
+	var res sendResult
 
 	if c.c.Debug {
 		log.Printf(
@@ -49,23 +254,34 @@ func (c *Client) Send(req *http.Request, v interface{}) error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return res, err
 	}
 	defer resp.Body.Close()
+	res.status = resp.StatusCode
+	if resp.StatusCode == http.StatusTooManyRequests {
+		res.retryAfter = retryAfter(resp.Header, time.Now())
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return res, err
+	}
+	if call, ok := v.(*CallResponse); ok {
+		call.StatusCode, call.Header, call.Raw = resp.StatusCode, resp.Header, body
+		v = call.out
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		var errResp *ErrorResponse
 		if len(body) == 0 {
-			return ErrResponseIsEmpty
+			return res, ErrResponseIsEmpty
 		}
-		if err := json.Unmarshal(body, &errResp); err != nil {
-			return err
+		errResp := &ErrorResponse{}
+		if err := decodeResponse(body, errResp, false); err != nil {
+			return res, err
 		}
+		errResp.HTTPStatus = resp.StatusCode
+		res.code = errResp.Code
+		res.paymentID = errResp.PaymentID
 
 		log.Printf(
 			"[RozetkaPay] Error --- type: %s, code: %s, message: %s, payment_id: %s, type: %s\n",
@@ -76,11 +292,13 @@ func (c *Client) Send(req *http.Request, v interface{}) error {
 			errResp.Type,
 		)
 
-		return errResp.ErrorCode()
+		return res, errResp.ErrorCode()
 	}
 
+	res.code, res.paymentID = responseSummary(body)
+
 	if v == nil {
-		return nil
+		return res, nil
 	}
 
 	if c.c.Debug {
@@ -94,7 +312,58 @@ func (c *Client) Send(req *http.Request, v interface{}) error {
 		)
 	}
 
-	return json.Unmarshal(body, v)
+	return res, decodeResponse(body, v, c.strict)
+}
+
+func requestOutcome(status int, err error) RequestOutcome {
+	switch {
+	case err == nil:
+		return RequestOutcomeSuccess
+	case status == 0:
+		return RequestOutcomeTransportError
+	default:
+		return RequestOutcomeError
+	}
+}
+
+// Extracts the payment status code and payment id from a successful response, if any.
+func responseSummary(body []byte) (PaymentStatusCode, string) {
+	var resp struct {
+		ID      string `json:"id"`
+		Details struct {
+			PaymentID  string            `json:"payment_id"`
+			StatusCode PaymentStatusCode `json:"status_code"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", ""
+	}
+	if resp.Details.PaymentID != "" {
+		return resp.Details.StatusCode, resp.Details.PaymentID
+	}
+	return resp.Details.StatusCode, resp.ID
+}
+
+// Extracts external_id from the query or the JSON body of the request without consuming it.
+func requestExternalID(req *http.Request) string {
+	if id := req.URL.Query().Get("external_id"); id != "" {
+		return id
+	}
+	if req.GetBody == nil {
+		return ""
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	var payload struct {
+		ExternalID string `json:"external_id"`
+	}
+	if err := json.NewDecoder(rc).Decode(&payload); err != nil {
+		return ""
+	}
+	return payload.ExternalID
 }
 
 func (c *Client) NewRequest(method, url string, payload interface{}, query map[string]string) (
@@ -125,89 +394,108 @@ func (c *Client) NewRequest(method, url string, payload interface{}, query map[s
 
 // Creates payment and performs desired operation.
 func (c *Client) CreatePayment(schema *CreatePaymentSchema) (*PaymentResponse, error) {
-	req, err := c.NewRequest(http.MethodPost, c.c.API+"payments/v1/new", schema, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp := &PaymentResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return Do(context.Background(), c, CreatePaymentEndpoint, schema)
 }
 
 // Confirm two-step payment.
 func (c *Client) ConfirmPayment(schema *ConfirmPaymentSchema) (*PaymentResponse, error) {
-	req, err := c.NewRequest(http.MethodPost, c.c.API+"payments/v1/confirm", schema, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp := &PaymentResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return Do(context.Background(), c, ConfirmPaymentEndpoint, schema)
 }
 
 // Cancel two-step payment.
 func (c *Client) CancelPayment(schema *CancelPaymentSchema) (*PaymentResponse, error) {
-	req, err := c.NewRequest(http.MethodPost, c.c.API+"payments/v1/cancel", schema, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp := &PaymentResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return Do(context.Background(), c, CancelPaymentEndpoint, schema)
 }
 
 // Refund one-step payment after withdrawal, or two-step payment after confirmation.
 func (c *Client) RefundPayment(schema *RefundPaymentSchema) (*PaymentResponse, error) {
-	req, err := c.NewRequest(http.MethodPost, c.c.API+"payments/v1/refund", schema, nil)
+	return Do(context.Background(), c, RefundPaymentEndpoint, schema)
+}
+
+// Get payment info by id.
+func (c *Client) GetPaymentInfo(externalID string) (*PaymentInfoResponse, error) {
+	return Do(context.Background(), c, PaymentInfoEndpoint, externalID)
+}
+
+// Parsing callback from the body.
+func (c *Client) GetPaymentCallbackFromBytes(body []byte) (*PaymentResponse, error) {
+	return c.parsePaymentCallback(context.Background(), body, "")
+}
+
+// Parsing callback from the incoming request, continuing the trace propagated in its headers.
+func (c *Client) GetPaymentCallbackFromRequest(r *http.Request) (*PaymentResponse, error) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		return nil, err
 	}
-	resp := &PaymentResponse{}
-	if err := c.Send(req, resp); err != nil {
+	return c.parsePaymentCallback(c.tracer.Extract(r.Context(), r.Header), body, "")
+}
+
+// The ledger operation is taken from earlier entries of the transaction if op is empty.
+func (c *Client) parsePaymentCallback(ctx context.Context, body []byte, op LedgerOperation) (*PaymentResponse, error) {
+	_, span := c.tracer.Start(ctx, "rozetkapay.callback")
+	defer span.End()
+	span.SetAttribute(SpanAttributeOperation, "callback")
+
+	if bytes.Equal(bytes.TrimSpace(body), []byte("null")) {
+		return nil, nil
+	}
+	callback := &PaymentResponse{}
+	if err := decodeResponse(body, callback, false); err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
-	return resp, nil
+	span.SetAttribute(SpanAttributeExternalID, callback.ExternalID)
+	span.SetAttribute(SpanAttributePaymentID, callback.Details.PaymentID)
+	if callback.Details.Status == PaymentStatusFailure {
+		span.SetAttribute(SpanAttributeErrorCode, string(callback.Details.StatusCode))
+	}
+	if c.ledger != nil && !c.isTestPayment(callback) {
+		if err := c.ledger.recordPayment(LedgerSourceCallback, op, callback); err != nil {
+			log.Printf("[RozetkaPay] Error --- type: %s, external_id: %s, message: %s\n", "ledger", callback.ExternalID, err)
+		}
+	}
+	return callback, nil
 }
 
-// Get payment info by id.
-func (c *Client) GetPaymentInfo(externalID string) (*PaymentInfoResponse, error) {
-	req, err := c.NewRequest(
-		http.MethodGet, c.c.API+"payments/v1/info",
-		nil, map[string]string{"external_id": externalID},
-	)
+// Parsing wallet callback from the body.
+func (c *Client) GetWalletCallbackFromBytes(body []byte) (*WalletCallback, error) {
+	return c.parseWalletCallback(context.Background(), body)
+}
+
+// Parsing wallet callback from the incoming request, continuing the trace propagated in its headers.
+func (c *Client) GetWalletCallbackFromRequest(r *http.Request) (*WalletCallback, error) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		return nil, err
 	}
-	resp := &PaymentInfoResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return c.parseWalletCallback(c.tracer.Extract(r.Context(), r.Header), body)
 }
 
-// Parsing callback from the body.
-func (c *Client) GetPaymentCallbackFromBytes(body []byte) (*PaymentResponse, error) {
-	var callback *PaymentResponse
-	if err := json.Unmarshal(body, &callback); err != nil {
+func (c *Client) parseWalletCallback(ctx context.Context, body []byte) (*WalletCallback, error) {
+	_, span := c.tracer.Start(ctx, "rozetkapay.callback")
+	defer span.End()
+	span.SetAttribute(SpanAttributeOperation, "wallet_callback")
+
+	if bytes.Equal(bytes.TrimSpace(body), []byte("null")) {
+		return nil, nil
+	}
+	callback := &WalletCallback{}
+	if err := decodeResponse(body, callback, false); err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
+	span.SetAttribute(SpanAttributeExternalID, callback.ExternalID)
+	if callback.Status == PaymentStatusFailure {
+		span.SetAttribute(SpanAttributeErrorCode, string(callback.StatusCode))
+	}
 	return callback, nil
 }
 
 // Prepares the data about the specified payment of transaction and sends it into callback_url which was provided on the payment step.
 // If the operation field is not provided the callback will be sent for the last operation.
 func (c *Client) ResendPaymentCallback(schema *PaymentCallbackResendSchema) (resended bool, err error) {
-	req, err := c.NewRequest(http.MethodPost, c.c.API+"payments/v1/callback/resend", schema, nil)
-	if err != nil {
-		return false, err
-	}
-	if err := c.Send(req, nil); err != nil {
+	if _, err := Do(context.Background(), c, ResendCallbackEndpoint, schema); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -217,50 +505,17 @@ func (c *Client) ResendPaymentCallback(schema *PaymentCallbackResendSchema) (res
 func (c *Client) AddWalletCustomerPayment(customerID string, schema *AddWalletCustomerSchema) (
 	*AddWalletCustomerResponse, error,
 ) {
-	req, err := c.NewRequest(
-		http.MethodPost, c.c.API+"customers/v1/wallet",
-		schema, map[string]string{"external_id": customerID},
-	)
-	if err != nil {
-		return nil, err
-	}
-	resp := &AddWalletCustomerResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return Do(context.Background(), c, AddWalletPaymentEndpoint, WalletRequest[*AddWalletCustomerSchema]{CustomerID: customerID, Schema: schema})
 }
 
 // Returns customer details including payment methods, if saved.
 func (c *Client) GetWalletCustomerPaymentInfo(customerID string) (*GetWalletInfoResponse, error) {
-	req, err := c.NewRequest(
-		http.MethodGet, c.c.API+"customers/v1/wallet",
-		nil, map[string]string{"external_id": customerID},
-	)
-	if err != nil {
-		return nil, err
-	}
-	resp := &GetWalletInfoResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return Do(context.Background(), c, WalletInfoEndpoint, customerID)
 }
 
 // Deletes customer payment method from wallet.
 func (c *Client) DeleteWalletCustomerPayment(customerID string, schema *DeleteWalletCustomerSchema) (
 	*DeleteWalletCustomerResponse, error,
 ) {
-	req, err := c.NewRequest(
-		http.MethodDelete, c.c.API+"customers/v1/wallet",
-		schema, map[string]string{"external_id": customerID},
-	)
-	if err != nil {
-		return nil, err
-	}
-	resp := &DeleteWalletCustomerResponse{}
-	if err := c.Send(req, resp); err != nil {
-		return nil, err
-	}
-	return resp, nil
+	return Do(context.Background(), c, DeleteWalletPaymentEndpoint, WalletRequest[*DeleteWalletCustomerSchema]{CustomerID: customerID, Schema: schema})
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func (a *app) batch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	output := fs.String("output", "", "file to write the results CSV to, stdout if not set")
+	journal := fs.String("journal", "", "progress journal file, rerun with the same file to resume")
+	concurrency := fs.Int("concurrency", 4, "number of lines processed at once")
+	rate := fs.Float64("rate", 5, "maximum lines processed per second, 0 for no limit")
+	pos, err := parseArgs(fs, args, "refund|cancel", "input.csv")
+	if err != nil {
+		return err
+	}
+
+	action := rozetkapay.BatchAction(pos[0])
+	if action != rozetkapay.BatchActionRefund && action != rozetkapay.BatchActionCancel {
+		return fmt.Errorf("batch: unknown action %q", pos[0])
+	}
+
+	in, err := os.Open(pos[1])
+	if err != nil {
+		return err
+	}
+	items, err := rozetkapay.ReadBatchCSV(in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+
+	opts := rozetkapay.BatchOptions{
+		Concurrency: *concurrency,
+		JournalPath: *journal,
+	}
+	if *rate > 0 {
+		opts.Limiter = rozetkapay.NewRateLimiter(rozetkapay.RateLimit{}, rozetkapay.RateLimit{Rate: *rate, Burst: 1})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, runErr := rozetkapay.NewBatchRunner(a.client, action, opts).Run(ctx, items)
+
+	var out io.Writer = a.out
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := rozetkapay.WriteBatchResultsCSV(out, results); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	counts := map[rozetkapay.BatchStatus]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(a.errOut, "done: %d, skipped: %d, invalid: %d, failed: %d\n",
+		counts[rozetkapay.BatchStatusDone],
+		counts[rozetkapay.BatchStatusSkipped],
+		counts[rozetkapay.BatchStatusInvalid],
+		counts[rozetkapay.BatchStatusFailed],
+	)
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func (a *app) info(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	pos, err := parseArgs(fs, args, "external_id")
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.GetPaymentInfo(pos[0])
+	if err != nil {
+		return err
+	}
+	return a.printPaymentInfo(resp)
+}
+
+func (a *app) create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	amount := fs.Float64("amount", 0, "amount of the order")
+	currency := fs.String("currency", "UAH", "currency of the order")
+	mode := fs.String("mode", string(rozetkapay.PaymentModeHosted), "hosted or direct")
+	confirm := fs.Bool("confirm", true, "debit the funds immediately, false for a two-step payment")
+	description := fs.String("description", "", "description of the order")
+	customer := fs.String("customer", "", "customer external id")
+	token := fs.String("token", "", "card token for direct payments")
+	optionID := fs.String("option-id", "", "wallet option id for direct payments")
+	pos, err := parseArgs(fs, args, "external_id")
+	if err != nil {
+		return err
+	}
+
+	schema := &rozetkapay.CreatePaymentSchema{
+		Amount:      *amount,
+		Currency:    *currency,
+		ExternalID:  pos[0],
+		Mode:        rozetkapay.PaymentMode(*mode),
+		CallbackURL: a.cfg.CallbackURL,
+		ResultURL:   a.cfg.ResultURL,
+		Confirm:     *confirm,
+		Description: *description,
+	}
+	if *customer != "" || *token != "" || *optionID != "" {
+		schema.Customer = &rozetkapay.CustomerData{ExternalID: *customer}
+	}
+	switch {
+	case *token != "":
+		schema.Customer.PaymentMethod = rozetkapay.PaymentMethod{
+			Type:    rozetkapay.PaymentMethodTypeCCToken,
+			CCToken: rozetkapay.CCToken{Token: *token},
+		}
+	case *optionID != "":
+		schema.Customer.PaymentMethod = rozetkapay.PaymentMethod{
+			Type:   rozetkapay.PaymentMethodTypeWallet,
+			Wallet: rozetkapay.Wallet{OptionID: *optionID},
+		}
+	}
+
+	resp, err := a.client.CreatePayment(schema)
+	if err != nil {
+		return err
+	}
+	return a.printPayment(resp)
+}
+
+func (a *app) confirm(args []string) error {
+	fs := flag.NewFlagSet("confirm", flag.ContinueOnError)
+	amount := fs.Float64("amount", 0, "amount to confirm, the whole payment if not set")
+	currency := fs.String("currency", "", "currency of the amount")
+	pos, err := parseArgs(fs, args, "external_id")
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.ConfirmPayment(&rozetkapay.ConfirmPaymentSchema{
+		ExternalID:  pos[0],
+		Amount:      *amount,
+		Currency:    *currency,
+		CallbackURL: a.cfg.CallbackURL,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printPayment(resp)
+}
+
+func (a *app) cancel(args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ContinueOnError)
+	amount := fs.Float64("amount", 0, "amount to cancel, the whole payment if not set")
+	currency := fs.String("currency", "", "currency of the amount")
+	pos, err := parseArgs(fs, args, "external_id")
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.CancelPayment(&rozetkapay.CancelPaymentSchema{
+		ExternalID:  pos[0],
+		Amount:      *amount,
+		Currency:    *currency,
+		CallbackURL: a.cfg.CallbackURL,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printPayment(resp)
+}
+
+func (a *app) refund(args []string) error {
+	fs := flag.NewFlagSet("refund", flag.ContinueOnError)
+	amount := fs.Float64("amount", 0, "amount to refund")
+	currency := fs.String("currency", "", "currency of the amount")
+	reason := fs.String("reason", "", "reason stored in the refund payload")
+	pos, err := parseArgs(fs, args, "external_id")
+	if err != nil {
+		return err
+	}
+	if *amount <= 0 {
+		return fmt.Errorf("refund: -amount is required")
+	}
+	resp, err := a.client.RefundPayment(&rozetkapay.RefundPaymentSchema{
+		ExternalID:  pos[0],
+		Amount:      *amount,
+		Currency:    *currency,
+		CallbackURL: a.cfg.CallbackURL,
+		Payload:     *reason,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printPayment(resp)
+}
+
+func (a *app) resendCallback(args []string) error {
+	fs := flag.NewFlagSet("resend-callback", flag.ContinueOnError)
+	operation := fs.String("operation", "", "operation to resend the callback for (payment, confirm, cancel, refund), the last one if not set")
+	concurrency := fs.Int("concurrency", 4, "number of callbacks requested at once")
+	ids, err := parseArgList(fs, args, "external_id")
+	if err != nil {
+		return err
+	}
+	op := rozetkapay.CallbackResendOperation(*operation)
+	if err := op.Validate(); err != nil {
+		return err
+	}
+
+	if len(ids) == 1 {
+		if _, err := a.client.ResendPaymentCallback(&rozetkapay.PaymentCallbackResendSchema{
+			ExternalID: ids[0],
+			Operation:  op,
+		}); err != nil {
+			return err
+		}
+		return a.printFields([][2]string{{"external_id", ids[0]}, {"resent", "true"}}, map[string]interface{}{
+			"external_id": ids[0],
+			"resent":      true,
+		})
+	}
+
+	if a.dryRun {
+		// Print the requests one after another instead of interleaved.
+		for _, id := range ids {
+			_, err := a.client.ResendPaymentCallback(&rozetkapay.PaymentCallbackResendSchema{ExternalID: id, Operation: op})
+			if !errors.Is(err, errDryRun) {
+				return err
+			}
+		}
+		return errDryRun
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := rozetkapay.NewCallbackResender(a.client, rozetkapay.ResendOptions{Concurrency: *concurrency}).Resend(ctx, ids, op)
+	if err != nil {
+		return err
+	}
+	if err := a.printResendReport(report); err != nil {
+		return err
+	}
+	if failed := len(report.Failed()); failed > 0 {
+		return fmt.Errorf("resend-callback: %d of %d callbacks not resent", failed, len(ids))
+	}
+	return nil
+}
+
+func (a *app) wallet(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("wallet: expected list, add or delete")
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("wallet list", flag.ContinueOnError)
+		pos, err := parseArgs(fs, args[1:], "customer")
+		if err != nil {
+			return err
+		}
+		resp, err := a.client.GetWalletCustomerPaymentInfo(pos[0])
+		if err != nil {
+			return err
+		}
+		return a.printWallet(resp)
+	case "add":
+		fs := flag.NewFlagSet("wallet add", flag.ContinueOnError)
+		token := fs.String("token", "", "card token to save")
+		pos, err := parseArgs(fs, args[1:], "customer")
+		if err != nil {
+			return err
+		}
+		if *token == "" {
+			return fmt.Errorf("wallet add: -token is required")
+		}
+		resp, err := a.client.AddWalletCustomerPayment(pos[0], &rozetkapay.AddWalletCustomerSchema{
+			CallbackURL: a.cfg.CallbackURL,
+			ResultURL:   a.cfg.ResultURL,
+			PaymentMethod: rozetkapay.PaymentMethod{
+				Type:    rozetkapay.PaymentMethodTypeCCToken,
+				CCToken: rozetkapay.CCToken{Token: *token},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		return a.printAddedWallet(resp)
+	case "delete":
+		fs := flag.NewFlagSet("wallet delete", flag.ContinueOnError)
+		typ := fs.String("type", string(rozetkapay.PaymentMethodTypeCCToken), "type of the payment method")
+		pos, err := parseArgs(fs, args[1:], "customer", "option_id")
+		if err != nil {
+			return err
+		}
+		resp, err := a.client.DeleteWalletCustomerPayment(pos[0], &rozetkapay.DeleteWalletCustomerSchema{
+			OptionID: pos[1],
+			Type:     rozetkapay.PaymentMethodType(*typ),
+		})
+		if err != nil {
+			return err
+		}
+		return a.printFields([][2]string{
+			{"option_id", resp.OptionID},
+			{"type", string(resp.Type)},
+			{"deleted", fmt.Sprint(resp.Delete)},
+		}, resp)
+	default:
+		return fmt.Errorf("wallet: unknown command %q", args[0])
+	}
+}
+
+func (a *app) call(args []string) error {
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	var query queryFlag
+	fs.Var(&query, "query", "query parameter as key=value, repeatable")
+	body := fs.String("body", "", "JSON request body")
+	pos, err := parseArgs(fs, args, "method", "path")
+	if err != nil {
+		return err
+	}
+	var payload interface{}
+	if *body != "" {
+		if !json.Valid([]byte(*body)) {
+			return fmt.Errorf("call: -body is not valid JSON")
+		}
+		payload = json.RawMessage(*body)
+	}
+
+	resp, err := a.client.Call(context.Background(), strings.ToUpper(pos[0]), pos[1], query, payload, nil)
+	if resp != nil && len(resp.Raw) > 0 {
+		var buf bytes.Buffer
+		if json.Indent(&buf, resp.Raw, "", "  ") == nil {
+			buf.WriteByte('\n')
+			a.out.Write(buf.Bytes())
+		} else {
+			fmt.Fprintf(a.out, "%s\n", resp.Raw)
+		}
+	}
+	return err
+}
+
+// Collects repeated key=value flags.
+type queryFlag map[string]string
+
+func (q *queryFlag) String() string {
+	return fmt.Sprint(map[string]string(*q))
+}
+
+func (q *queryFlag) Set(v string) error {
+	i := strings.IndexByte(v, '=')
+	if i < 0 {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	if *q == nil {
+		*q = queryFlag{}
+	}
+	(*q)[v[:i]] = v[i+1:]
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+// Builds the client config from the config file, overridden by the environment.
+func loadConfig(path string) (*rozetkapay.Config, error) {
+	cfg, err := rozetkapay.LoadConfig(path)
+	if errors.Is(err, rozetkapay.ErrMissingCredentials) {
+		return nil, errors.New("credentials are not set, use ROZETKAPAY_LOGIN and ROZETKAPAY_PASSWORD or -config")
+	}
+	return cfg, err
+}
@@ -0,0 +1,159 @@
+// Command rozetkapay performs RozetkaPay gateway operations from the command line.
+//
+// Credentials are read from the ROZETKAPAY_LOGIN and ROZETKAPAY_PASSWORD environment variables
+// or from a JSON or "key: value" config file given with -config or ROZETKAPAY_CONFIG.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+const usage = `Usage: rozetkapay [flags] <command> [arguments]
+
+Commands:
+  info <external_id>                     show payment details
+  create <external_id> -amount -currency create a payment
+  confirm <external_id> [-amount]        confirm a two-step payment
+  cancel <external_id> [-amount]         cancel a two-step payment
+  refund <external_id> -amount           refund a payment
+  resend-callback <external_id>...       send payment callbacks again
+  wallet list <customer>                 list saved payment methods
+  wallet add <customer> -token           save a card token to the wallet
+  wallet delete <customer> <option_id>   delete a saved payment method
+  batch refund|cancel <input.csv>        refund or cancel payments listed in a CSV
+  call <method> <path> [-query] [-body]  call any API endpoint and print the response
+
+Flags:
+`
+
+type app struct {
+	client *rozetkapay.Client
+	cfg    *rozetkapay.Config
+	out    io.Writer
+	errOut io.Writer
+	json   bool
+	dryRun bool
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, errDryRun) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "rozetkapay:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("rozetkapay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", os.Getenv("ROZETKAPAY_CONFIG"), "path to a JSON or key: value config file with credentials")
+	jsonOutput := fs.Bool("json", false, "print responses as JSON")
+	dryRun := fs.Bool("dry-run", false, "print the request instead of sending it")
+	debug := fs.Bool("debug", false, "log requests and responses")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *debug {
+		cfg.SetDebugMode(true)
+	}
+
+	var opts []rozetkapay.ClientOpts
+	if *dryRun {
+		opts = append(opts, rozetkapay.WithCustomHTTPClient(dryRunClient(stdout)))
+	}
+
+	a := &app{
+		client: rozetkapay.NewClient(cfg, opts...),
+		cfg:    cfg,
+		out:    stdout,
+		errOut: stderr,
+		json:   *jsonOutput,
+		dryRun: *dryRun,
+	}
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "info":
+		return a.info(rest)
+	case "create":
+		return a.create(rest)
+	case "confirm":
+		return a.confirm(rest)
+	case "cancel":
+		return a.cancel(rest)
+	case "refund":
+		return a.refund(rest)
+	case "resend-callback":
+		return a.resendCallback(rest)
+	case "wallet":
+		return a.wallet(rest)
+	case "batch":
+		return a.batch(rest)
+	case "call":
+		return a.call(rest)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// Parses flags placed before, after or between positional arguments
+// and checks the number of positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string, positional ...string) ([]string, error) {
+	values, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(positional) {
+		return nil, fmt.Errorf("%s: expected arguments %v, got %d", fs.Name(), positional, len(values))
+	}
+	return values, nil
+}
+
+// Parses flags like parseArgs, accepting one or more values of the named argument.
+func parseArgList(fs *flag.FlagSet, args []string, name string) ([]string, error) {
+	values, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%s: expected one or more %s arguments", fs.Name(), name)
+	}
+	return values, nil
+}
+
+// Parses flags placed before, between or after the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var values []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return values, nil
+		}
+		values = append(values, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs a command with -dry-run and returns the decoded request body.
+func dryRun(t *testing.T, args ...string) map[string]interface{} {
+	t.Helper()
+	t.Setenv("ROZETKAPAY_CONFIG", "")
+	t.Setenv("ROZETKAPAY_LOGIN", "merchant")
+	t.Setenv("ROZETKAPAY_PASSWORD", "secret")
+
+	var stdout, stderr bytes.Buffer
+	if err := run(append([]string{"-dry-run"}, args...), &stdout, &stderr); !errors.Is(err, errDryRun) {
+		t.Fatalf("run error = %v, stderr: %s", err, stderr.String())
+	}
+	_, body, ok := strings.Cut(stdout.String(), "\n\n")
+	if !ok {
+		t.Fatalf("no request body in:\n%s", stdout.String())
+	}
+	var req map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("request body %q: %v", body, err)
+	}
+	return req
+}
+
+func TestCreateHostedWithoutCustomer(t *testing.T) {
+	req := dryRun(t, "create", "-amount", "10", "order-1")
+	if _, ok := req["customer"]; ok {
+		t.Fatalf("hosted create sent a customer: %v", req["customer"])
+	}
+}
+
+func TestCreateSetsOnlyGivenPaymentMethod(t *testing.T) {
+	req := dryRun(t, "create", "-amount", "10", "-mode", "direct", "-token", "tok_visa", "order-1")
+	method, _ := req["customer"].(map[string]interface{})["payment_method"].(map[string]interface{})
+	if method["type"] != "cc_token" || method["cc_token"] == nil {
+		t.Fatalf("payment method %v", method)
+	}
+	for _, key := range []string{"apple_pay", "google_pay", "wallet"} {
+		if _, ok := method[key]; ok {
+			t.Errorf("payment method has %s", key)
+		}
+	}
+
+	req = dryRun(t, "create", "-amount", "10", "-customer", "customer-1", "order-1")
+	customer, _ := req["customer"].(map[string]interface{})
+	if customer["external_id"] != "customer-1" {
+		t.Fatalf("customer %v", customer)
+	}
+	if _, ok := customer["payment_method"]; ok {
+		t.Fatalf("customer has a payment method: %v", customer["payment_method"])
+	}
+}
+
+func TestBatchWritesSummaryToStderr(t *testing.T) {
+	t.Setenv("ROZETKAPAY_CONFIG", "")
+	t.Setenv("ROZETKAPAY_LOGIN", "merchant")
+	t.Setenv("ROZETKAPAY_PASSWORD", "secret")
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.csv")
+	if err := os.WriteFile(input, []byte("order-1,10.00,UAH\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-dry-run", "batch", "-rate", "0", "-output", filepath.Join(dir, "results.csv"), "refund", input}
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatalf("run error = %v, stderr: %s", err, stderr.String())
+	}
+	if got := stderr.String(); !strings.Contains(got, "failed: 1") {
+		t.Fatalf("stderr %q has no batch summary", got)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+var errDryRun = errors.New("dry run")
+
+// Returns an HTTP client printing requests instead of sending them.
+func dryRunClient(w io.Writer) *http.Client {
+	return &http.Client{Transport: dryRunTransport{w}}
+}
+
+type dryRunTransport struct {
+	w io.Writer
+}
+
+func (t dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fmt.Fprintf(t.w, "%s %s\n", req.Method, req.URL)
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, v := range req.Header[key] {
+			if key == "Authorization" {
+				v = "Basic ***"
+			}
+			fmt.Fprintf(t.w, "%s: %s\n", key, v)
+		}
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, body, "", "  ") == nil {
+			body = pretty.Bytes()
+		}
+		fmt.Fprintf(t.w, "\n%s\n", body)
+	}
+	return nil, errDryRun
+}
+
+func (a *app) printJSON(v interface{}) error {
+	enc := json.NewEncoder(a.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Prints rows as an aligned table, or v as JSON when requested.
+func (a *app) printFields(rows [][2]string, v interface{}) error {
+	if a.json {
+		return a.printJSON(v)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\n", row[0], row[1])
+	}
+	return tw.Flush()
+}
+
+func (a *app) printPayment(resp *rozetkapay.PaymentResponse) error {
+	rows := [][2]string{
+		{"id", resp.ID},
+		{"external_id", resp.ExternalID},
+		{"status", string(resp.Details.Status)},
+		{"status_code", string(resp.Details.StatusCode)},
+		{"amount", resp.Details.Amount + " " + resp.Details.Currency},
+		{"transaction_id", resp.Details.TransactionID},
+	}
+	if resp.ActionRequired {
+		rows = append(rows, [2]string{"action", resp.Action.Type + " " + resp.Action.Value})
+	}
+	return a.printFields(rows, resp)
+}
+
+func (a *app) printPaymentInfo(resp *rozetkapay.PaymentInfoResponse) error {
+	if a.json {
+		return a.printJSON(resp)
+	}
+	if err := a.printFields([][2]string{
+		{"id", resp.ID},
+		{"external_id", resp.ExternalID},
+		{"created_at", formatTime(resp.CreatedAt)},
+		{"amount", resp.Amount + " " + resp.Currency},
+		{"confirmed", resp.AmountConfirmed},
+		{"canceled", resp.AmountCanceled},
+		{"refunded", resp.AmountRefunded},
+		{"receipt_url", resp.ReceiptURL},
+	}, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.out)
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tAMOUNT\tSTATUS\tSTATUS_CODE\tTRANSACTION_ID\tPROCESSED_AT")
+	row := func(op, amount, currency, status, code, transactionID string, processedAt time.Time) {
+		fmt.Fprintf(tw, "%s\t%s %s\t%s\t%s\t%s\t%s\n", op, amount, currency, status, code, transactionID, formatTime(processedAt))
+	}
+	for _, d := range resp.PurchaseDetails {
+		row("purchase", d.Amount, d.Currency, d.Status, d.StatusCode, d.TransactionID, d.ProcessedAt)
+	}
+	for _, d := range resp.ConfirmationDetails {
+		row("confirmation", d.Amount, d.Currency, d.Status, d.StatusCode, d.TransactionID, d.ProcessedAt)
+	}
+	for _, d := range resp.CancellationDetails {
+		row("cancellation", d.Amount, d.Currency, d.Status, d.StatusCode, d.TransactionID, d.ProcessedAt)
+	}
+	for _, d := range resp.RefundDetails {
+		row("refund", d.Amount, d.Currency, d.Status, d.StatusCode, d.TransactionID, d.ProcessedAt)
+	}
+	return tw.Flush()
+}
+
+func (a *app) printWallet(resp *rozetkapay.GetWalletInfoResponse) error {
+	if a.json {
+		return a.printJSON(resp)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPTION_ID\tTYPE\tNAME\tMASK\tEXPIRES_AT")
+	for _, e := range resp.Wallet {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.OptionID, e.Type, e.Name, e.Card.Mask, e.Card.ExpiresAt.Format("2006-01"))
+	}
+	return tw.Flush()
+}
+
+func (a *app) printResendReport(report *rozetkapay.ResendReport) error {
+	if a.json {
+		return a.printJSON(report)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "EXTERNAL_ID\tRESENT\tERROR")
+	for _, r := range report.Results {
+		fmt.Fprintf(tw, "%s\t%t\t%s\n", r.ExternalID, r.Resent, r.Error)
+	}
+	return tw.Flush()
+}
+
+func (a *app) printAddedWallet(resp *rozetkapay.AddWalletCustomerResponse) error {
+	rows := [][2]string{
+		{"status", string(resp.Status)},
+		{"option_id", resp.PaymentMethod.OptionID},
+		{"mask", resp.PaymentMethod.Card.Mask},
+	}
+	if resp.ActionRequired {
+		rows = append(rows, [2]string{"action", resp.Action.Type + " " + resp.Action.Value})
+	}
+	return a.printFields(rows, resp)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,7 +1,8 @@
-package main
+package rozetkapay
 
 import (
 	"encoding/base64"
+	"fmt"
 )
 
 const (
@@ -16,14 +17,33 @@ type Config struct {
 	ResultURL   string
 	CallbackURL string
 	Debug       bool
+
+	// Guards confirmations and refunds against credentials of the other environment.
+	// Treated as custom, which is not guarded, if empty.
+	Environment Environment
+
+	// Logins of sandbox credentials besides DevLogin.
+	SandboxLogins []string
+
+	// Timeouts and connection pool limits of the HTTP client built by NewClient.
+	// Ignored when the client is created with WithCustomHTTPClient.
+	Transport TransportConfig
 }
 
+// The environment is the sandbox for the public test login and production otherwise,
+// set it with SetEnvironment for other sandbox credentials.
 func NewConfig(login, password string) *Config {
+	env := EnvironmentProduction
+	if login == DevLogin {
+		env = EnvironmentSandbox
+	}
 	return &Config{
 		BasicAuth: base64.StdEncoding.EncodeToString(
 			[]byte(login + ":" + password),
 		),
-		API: API_URL,
+		API:         API_URL,
+		Environment: env,
+		Transport:   DefaultTransportConfig(),
 	}
 }
 
@@ -32,8 +52,10 @@ func NewDevelopmentConfig() *Config {
 		BasicAuth: base64.StdEncoding.EncodeToString(
 			[]byte(DevLogin + ":" + DevPassword),
 		),
-		API:   API_URL,
-		Debug: true,
+		API:         API_URL,
+		Debug:       true,
+		Environment: EnvironmentSandbox,
+		Transport:   DefaultTransportConfig(),
 	}
 }
 
@@ -51,3 +73,27 @@ func (c *Config) SetDebugMode(debug bool) *Config {
 	c.Debug = debug
 	return c
 }
+
+func (c *Config) SetEnvironment(env Environment) *Config {
+	c.Environment = env
+	return c
+}
+
+func (c *Config) SetTransport(transport TransportConfig) *Config {
+	c.Transport = transport
+	return c
+}
+
+// Returns the config with the credentials redacted.
+func (c Config) String() string {
+	auth := ""
+	if c.BasicAuth != "" {
+		auth = "***"
+	}
+	return fmt.Sprintf("Config{API: %s, Environment: %s, BasicAuth: %s, ResultURL: %s, CallbackURL: %s, Debug: %t}",
+		c.API, c.Environment, auth, c.ResultURL, c.CallbackURL, c.Debug)
+}
+
+func (c Config) GoString() string {
+	return c.String()
+}
@@ -0,0 +1,270 @@
+package rozetkapay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingCredentials error = errors.New("credentials are not set")
+)
+
+// Environment variables read by ConfigFromEnv and LoadConfig.
+const (
+	EnvLogin       = "ROZETKAPAY_LOGIN"
+	EnvPassword    = "ROZETKAPAY_PASSWORD"
+	EnvAPIURL      = "ROZETKAPAY_API_URL"
+	EnvCallbackURL = "ROZETKAPAY_CALLBACK_URL"
+	EnvResultURL   = "ROZETKAPAY_RESULT_URL"
+	EnvDebug       = "ROZETKAPAY_DEBUG"
+	EnvEnvironment = "ROZETKAPAY_ENVIRONMENT"
+)
+
+// Config keys of config files and the environment variables they are read from.
+var configKeys = map[string]string{
+	"login":        EnvLogin,
+	"password":     EnvPassword,
+	"api_url":      EnvAPIURL,
+	"callback_url": EnvCallbackURL,
+	"result_url":   EnvResultURL,
+	"debug":        EnvDebug,
+	"environment":  EnvEnvironment,
+}
+
+type Credentials struct {
+	Login    string
+	Password string
+}
+
+func (c Credentials) basicAuth() string {
+	return base64.StdEncoding.EncodeToString([]byte(c.Login + ":" + c.Password))
+}
+
+// Returns the login with the password redacted.
+func (c Credentials) String() string {
+	return c.Login + ":***"
+}
+
+// Builds the config from the ROZETKAPAY_* environment variables.
+func ConfigFromEnv() (*Config, error) {
+	return configFromValues(envConfigValues(map[string]string{}))
+}
+
+// Builds the config from a file, see LoadConfig for the format.
+func LoadConfigFile(path string) (*Config, error) {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return configFromValues(values)
+}
+
+// Builds the config from the file, if the path is not empty, with the ROZETKAPAY_* environment variables taking precedence.
+// The file is either a JSON object or lines of "key: value" or "key = value", as in flat YAML or TOML files,
+// with the keys login, password, api_url, callback_url, result_url, environment and debug.
+func LoadConfig(path string) (*Config, error) {
+	values := map[string]string{}
+	if path != "" {
+		var err error
+		if values, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return configFromValues(envConfigValues(values))
+}
+
+func envConfigValues(values map[string]string) map[string]string {
+	for key, env := range configKeys {
+		if v := os.Getenv(env); v != "" {
+			values[key] = v
+		}
+	}
+	return values
+}
+
+func configFromValues(values map[string]string) (*Config, error) {
+	if values["login"] == "" || values["password"] == "" {
+		return nil, ErrMissingCredentials
+	}
+	cfg := NewConfig(values["login"], values["password"]).
+		SetCallbackURL(values["callback_url"]).
+		SetResultURL(values["result_url"])
+	if values["api_url"] != "" {
+		cfg.API = values["api_url"]
+	}
+	if v := values["environment"]; v != "" {
+		env, err := ParseEnvironment(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SetEnvironment(env)
+	}
+	if v := values["debug"]; v != "" {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid debug value %q", v)
+		}
+		cfg.SetDebugMode(debug)
+	}
+	return cfg, nil
+}
+
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseConfigValues(b)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// Parses a JSON object or "key: value" / "key = value" lines.
+// Comment lines starting with # and section headers are skipped.
+// JSON values must be strings, numbers or booleans, numbers are taken as written.
+func parseConfigValues(b []byte) (map[string]string, error) {
+	values := map[string]string{}
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var raw map[string]interface{}
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		for key, v := range raw {
+			if _, ok := configKeys[key]; !ok {
+				return nil, fmt.Errorf("unknown key %q", key)
+			}
+			switch v := v.(type) {
+			case string:
+				values[key] = v
+			case json.Number:
+				values[key] = v.String()
+			case bool:
+				values[key] = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("key %q: expected a string, number or boolean", key)
+			}
+		}
+		return values, nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || line == "---" {
+			continue
+		}
+		i := strings.IndexAny(line, ":=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if _, ok := configKeys[key]; !ok {
+			return nil, fmt.Errorf("line %d: unknown key %q", n, key)
+		}
+		values[key] = unquote(strings.TrimSpace(line[i+1:]))
+	}
+	return values, sc.Err()
+}
+
+// Strips the quotes around the value, dropping anything after the closing quote such as a comment.
+// Unquoted values are taken whole, a # in them is part of the value.
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') {
+		if end := strings.IndexByte(v[1:], v[0]); end >= 0 {
+			return v[1 : end+1]
+		}
+	}
+	return v
+}
+
+// CredentialsProvider supplies the gateway credentials, e.g. from a secret store.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials always provides the same credentials.
+type StaticCredentials Credentials
+
+func (c StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// EnvCredentials provides the credentials from the ROZETKAPAY_LOGIN and ROZETKAPAY_PASSWORD environment variables.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	c := Credentials{Login: os.Getenv(EnvLogin), Password: os.Getenv(EnvPassword)}
+	if c.Login == "" || c.Password == "" {
+		return Credentials{}, ErrMissingCredentials
+	}
+	return c, nil
+}
+
+// FileCredentials provides the credentials from a config file, such as one kept up to date by a vault sidecar.
+// The file is read on every call, in the format of LoadConfig.
+type FileCredentials struct {
+	Path string
+}
+
+func (f FileCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	values, err := readConfigFile(f.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c := Credentials{Login: values["login"], Password: values["password"]}
+	if c.Login == "" || c.Password == "" {
+		return Credentials{}, fmt.Errorf("config %s: %w", f.Path, ErrMissingCredentials)
+	}
+	return c, nil
+}
+
+// Loads the credentials and passes them to apply, then reloads them in the background
+// every interval until the context is done, passing them on whenever they change.
+// Only the first load fails the call, later failures are logged and the current credentials are kept.
+// The interval must be positive.
+func WatchCredentials(ctx context.Context, p CredentialsProvider, interval time.Duration, apply func(Credentials)) error {
+	if interval <= 0 {
+		return fmt.Errorf("credentials watch interval must be positive, got %s", interval)
+	}
+	current, err := p.Credentials(ctx)
+	if err != nil {
+		return err
+	}
+	apply(current)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			c, err := p.Credentials(ctx)
+			if err != nil {
+				log.Printf("[RozetkaPay] Error --- type: %s, message: %s\n", "credentials", err)
+				continue
+			}
+			if c != current {
+				current = c
+				apply(c)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,112 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileKeyValue(t *testing.T) {
+	path := writeConfig(t, "rozetkapay.yaml", `# credentials
+login: merchant
+password: abc #1
+callback_url: "https://shop.example/callback" # quoted values may have comments
+debug = true
+`)
+	cfg, err := rozetkapay.LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := rozetkapay.FileCredentials{Path: path}.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Login != "merchant" || creds.Password != "abc #1" {
+		t.Fatalf("credentials %q:%q", creds.Login, creds.Password)
+	}
+	if cfg.CallbackURL != "https://shop.example/callback" {
+		t.Fatalf("callback url %q", cfg.CallbackURL)
+	}
+}
+
+func TestLoadConfigFileJSON(t *testing.T) {
+	path := writeConfig(t, "rozetkapay.json", `{"login": "merchant", "password": 12345678901, "debug": true}`)
+	creds, err := rozetkapay.FileCredentials{Path: path}.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Password != "12345678901" {
+		t.Fatalf("numeric password read as %q", creds.Password)
+	}
+
+	for _, content := range []string{
+		`{"login": "merchant", "password": ["secret"]}`,
+		`{"login": "merchant", "password": null}`,
+		`{"login": "merchant", "password": "secret", "user": "x"}`,
+	} {
+		if _, err := rozetkapay.LoadConfigFile(writeConfig(t, "rozetkapay.json", content)); err == nil {
+			t.Errorf("LoadConfigFile accepted %s", content)
+		}
+	}
+}
+
+type sequenceCredentials struct {
+	mu    sync.Mutex
+	calls int
+	creds []rozetkapay.Credentials
+}
+
+func (s *sequenceCredentials) Credentials(ctx context.Context) (rozetkapay.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.creds[s.calls]
+	if s.calls < len(s.creds)-1 {
+		s.calls++
+	}
+	return c, nil
+}
+
+func TestWatchCredentials(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &sequenceCredentials{creds: []rozetkapay.Credentials{{Login: "a", Password: "1"}, {Login: "a", Password: "2"}}}
+	applied := make(chan rozetkapay.Credentials, 2)
+	if err := rozetkapay.WatchCredentials(ctx, p, time.Millisecond, func(c rozetkapay.Credentials) { applied <- c }); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-applied; c.Password != "1" {
+		t.Fatalf("first credentials %v", c)
+	}
+	select {
+	case c := <-applied:
+		if c.Password != "2" {
+			t.Fatalf("reloaded credentials %v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("changed credentials not applied")
+	}
+}
+
+func TestWatchCredentialsRejectsInterval(t *testing.T) {
+	p := rozetkapay.StaticCredentials{Login: "merchant", Password: "secret"}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := rozetkapay.WatchCredentials(context.Background(), p, interval, func(rozetkapay.Credentials) {}); err == nil {
+			t.Errorf("interval %s accepted", interval)
+		}
+	}
+}
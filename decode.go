@@ -0,0 +1,106 @@
+package rozetkapay
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RawFields keeps the body a response was decoded from and its top-level fields unknown to the SDK.
+// It is embedded into every response type.
+type RawFields struct {
+	// Response body as received from the gateway.
+	Raw json.RawMessage `json:"-"`
+
+	// Top-level fields of the body with no counterpart in the response type, by name.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (f *RawFields) setRaw(raw json.RawMessage, extra map[string]json.RawMessage) {
+	f.Raw, f.Extra = raw, extra
+}
+
+type rawSetter interface {
+	setRaw(raw json.RawMessage, extra map[string]json.RawMessage)
+}
+
+// Fails decoding of gateway responses with fields, at any depth, the SDK does not know.
+// Values of types with their own UnmarshalJSON, such as Properties, are decoded by it and not checked.
+// Meant for contract tests, error responses and callbacks are always decoded leniently.
+func WithStrictDecoding() ClientOpts {
+	return func(m *Client) {
+		m.strict = true
+	}
+}
+
+// Decodes body into v and keeps the raw body and unknown fields if v is a response type.
+func decodeResponse(body []byte, v interface{}, strict bool) error {
+	if strict {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(body, v); err != nil {
+		return err
+	}
+
+	s, ok := v.(rawSetter)
+	if !ok {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	known := knownFields(reflect.TypeOf(v).Elem())
+	var extra map[string]json.RawMessage
+	for name, value := range fields {
+		if known[strings.ToLower(name)] {
+			continue
+		}
+		if extra == nil {
+			extra = map[string]json.RawMessage{}
+		}
+		extra[name] = value
+	}
+	s.setRaw(append(json.RawMessage(nil), body...), extra)
+	return nil
+}
+
+// Lowercased JSON names of struct types, by type.
+var knownFieldsCache sync.Map
+
+// Returns the lowercased JSON field names of the struct type,
+// as encoding/json matches object keys case-insensitively.
+func knownFields(t reflect.Type) map[string]bool {
+	if known, ok := knownFieldsCache.Load(t); ok {
+		return known.(map[string]bool)
+	}
+	known := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n := range knownFields(f.Type) {
+				known[n] = true
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		known[strings.ToLower(name)] = true
+	}
+	knownFieldsCache.Store(t, known)
+	return known
+}
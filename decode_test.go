@@ -0,0 +1,92 @@
+package rozetkapay_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+// Client of a gateway answering every request with the body.
+func bodyClient(t *testing.T, body string, opts ...rozetkapay.ClientOpts) *rozetkapay.Client {
+	t.Helper()
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(gateway.Close)
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	return rozetkapay.NewClient(cfg, opts...)
+}
+
+func createPayment(c *rozetkapay.Client) (*rozetkapay.PaymentResponse, error) {
+	return c.CreatePayment(&rozetkapay.CreatePaymentSchema{Amount: 10, Currency: "UAH", ExternalID: "order-1"})
+}
+
+func TestDecodeKeepsRawAndExtraFields(t *testing.T) {
+	body := `{"id":"p1","External_ID":"order-1","new_field":{"a":1},"details":{"amount":"10.00","new_detail":true}}`
+	resp, err := createPayment(bodyClient(t, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "p1" || resp.ExternalID != "order-1" || resp.Details.Amount != "10.00" {
+		t.Fatalf("decoded %+v", resp)
+	}
+	if string(resp.Raw) != body {
+		t.Fatalf("raw %s", resp.Raw)
+	}
+	// Only top-level fields are kept, keys are matched case-insensitively like encoding/json does.
+	if len(resp.Extra) != 1 || string(resp.Extra["new_field"]) != `{"a":1}` {
+		t.Fatalf("extra %v", resp.Extra)
+	}
+
+	resp, err = createPayment(bodyClient(t, `{"id":"p1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Extra != nil {
+		t.Fatalf("extra %v for a body without unknown fields", resp.Extra)
+	}
+}
+
+func TestStrictDecodingRejectsUnknownFields(t *testing.T) {
+	for _, body := range []string{
+		`{"id":"p1","new_field":1}`,
+		`{"id":"p1","details":{"amount":"10.00","new_detail":true}}`,
+	} {
+		if _, err := createPayment(bodyClient(t, body, rozetkapay.WithStrictDecoding())); err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Errorf("strict decoding of %s: %v", body, err)
+		}
+		if _, err := createPayment(bodyClient(t, body)); err != nil {
+			t.Errorf("lenient decoding of %s: %v", body, err)
+		}
+	}
+
+	// Properties decode themselves, their keys are arbitrary.
+	body := `{"id":"p1","details":{"properties":{"anything":1}}}`
+	resp, err := createPayment(bodyClient(t, body, rozetkapay.WithStrictDecoding()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Details.Properties.Get("anything") != "1" {
+		t.Fatalf("properties %v", resp.Details.Properties)
+	}
+}
+
+func TestStrictDecodingSkipsErrorResponses(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"invalid_request","message":"bad","new_field":1}`))
+	}))
+	defer gateway.Close()
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+
+	_, err := createPayment(rozetkapay.NewClient(cfg, rozetkapay.WithStrictDecoding()))
+	if code, ok := rozetkapay.ErrorStatusCode(err); !ok || code != "invalid_request" {
+		t.Fatalf("error %v", err)
+	}
+}
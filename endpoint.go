@@ -0,0 +1,146 @@
+package rozetkapay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNilSchema error = errors.New("request schema is nil")
+)
+
+// Endpoint describes a gateway endpoint taking Req and answering Resp.
+// Calls made with Do go through Send like every other call, so retries, rate limiting,
+// the circuit breaker, metrics, tracing and the ledger apply to them as well.
+type Endpoint[Req, Resp any] struct {
+	Method string
+
+	// Path relative to Config.API, e.g. "payments/v1/new".
+	Path string
+
+	// Builds the query parameters, none if nil.
+	Query func(req Req) map[string]string
+
+	// Returns the request body, the request itself if nil. A nil body sends no body.
+	Body func(req Req) interface{}
+
+	// Checks the request before it is sent, the request is not checked if nil.
+	Validate func(req Req) error
+}
+
+// Request of the wallet endpoints, which name the customer in the query.
+type WalletRequest[S any] struct {
+	CustomerID string
+	Schema     S
+}
+
+// Endpoints of the gateway API.
+var (
+	CreatePaymentEndpoint = Endpoint[*CreatePaymentSchema, PaymentResponse]{
+		Method: http.MethodPost,
+		Path:   "payments/v1/new",
+	}
+
+	ConfirmPaymentEndpoint = Endpoint[*ConfirmPaymentSchema, PaymentResponse]{
+		Method: http.MethodPost,
+		Path:   "payments/v1/confirm",
+	}
+
+	CancelPaymentEndpoint = Endpoint[*CancelPaymentSchema, PaymentResponse]{
+		Method: http.MethodPost,
+		Path:   "payments/v1/cancel",
+	}
+
+	RefundPaymentEndpoint = Endpoint[*RefundPaymentSchema, PaymentResponse]{
+		Method: http.MethodPost,
+		Path:   "payments/v1/refund",
+	}
+
+	PaymentInfoEndpoint = Endpoint[string, PaymentInfoResponse]{
+		Method: http.MethodGet,
+		Path:   "payments/v1/info",
+		Query:  externalIDQuery,
+		Body:   noBody[string],
+	}
+
+	ResendCallbackEndpoint = Endpoint[*PaymentCallbackResendSchema, struct{}]{
+		Method: http.MethodPost,
+		Path:   "payments/v1/callback/resend",
+		Validate: func(s *PaymentCallbackResendSchema) error {
+			if s == nil {
+				return ErrNilSchema
+			}
+			return s.Operation.Validate()
+		},
+	}
+
+	AddWalletPaymentEndpoint = Endpoint[WalletRequest[*AddWalletCustomerSchema], AddWalletCustomerResponse]{
+		Method: http.MethodPost,
+		Path:   "customers/v1/wallet",
+		Query:  walletQuery[*AddWalletCustomerSchema],
+		Body:   walletBody[*AddWalletCustomerSchema],
+	}
+
+	WalletInfoEndpoint = Endpoint[string, GetWalletInfoResponse]{
+		Method: http.MethodGet,
+		Path:   "customers/v1/wallet",
+		Query:  externalIDQuery,
+		Body:   noBody[string],
+	}
+
+	DeleteWalletPaymentEndpoint = Endpoint[WalletRequest[*DeleteWalletCustomerSchema], DeleteWalletCustomerResponse]{
+		Method: http.MethodDelete,
+		Path:   "customers/v1/wallet",
+		Query:  walletQuery[*DeleteWalletCustomerSchema],
+		Body:   walletBody[*DeleteWalletCustomerSchema],
+	}
+)
+
+// Calls the endpoint. A struct{} response is not decoded.
+func Do[Req, Resp any](ctx context.Context, c *Client, e Endpoint[Req, Resp], req Req) (*Resp, error) {
+	if e.Validate != nil {
+		if err := e.Validate(req); err != nil {
+			return nil, err
+		}
+	}
+	body := interface{}(req)
+	if e.Body != nil {
+		body = e.Body(req)
+	}
+
+	var query map[string]string
+	if e.Query != nil {
+		query = e.Query(req)
+	}
+	r, err := c.NewRequest(e.Method, c.c.API+e.Path, body, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(Resp)
+	var out interface{} = resp
+	if _, empty := out.(*struct{}); empty {
+		out = nil
+	}
+	if err := c.Send(r.WithContext(ctx), out); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func noBody[Req any](Req) interface{} {
+	return nil
+}
+
+func externalIDQuery(externalID string) map[string]string {
+	return map[string]string{"external_id": externalID}
+}
+
+func walletQuery[S any](r WalletRequest[S]) map[string]string {
+	return externalIDQuery(r.CustomerID)
+}
+
+func walletBody[S any](r WalletRequest[S]) interface{} {
+	return r.Schema
+}
@@ -0,0 +1,123 @@
+package rozetkapay
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrEnvironmentMismatch error = errors.New("credentials do not match the environment")
+)
+
+type Environment string
+
+const (
+	// Real payments, sandbox credentials are refused for confirmations and refunds.
+	EnvironmentProduction Environment = "production"
+
+	// Test payments, only sandbox credentials may confirm and refund.
+	EnvironmentSandbox Environment = "sandbox"
+
+	// Any other gateway, such as a local fake, nothing is checked.
+	EnvironmentCustom Environment = "custom"
+)
+
+func ParseEnvironment(s string) (Environment, error) {
+	switch env := Environment(strings.ToLower(strings.TrimSpace(s))); env {
+	case EnvironmentProduction, EnvironmentSandbox, EnvironmentCustom:
+		return env, nil
+	}
+	return "", fmt.Errorf("unknown environment %q", s)
+}
+
+// Operations moving money that are refused when the credentials do not match the environment.
+var guardedOperations = map[Operation]bool{
+	OperationConfirmPayment: true,
+	OperationRefundPayment:  true,
+}
+
+// Returns the environment of the client, custom if the config does not name one.
+func (c *Client) Environment() Environment {
+	if c.c.Environment == "" {
+		return EnvironmentCustom
+	}
+	return c.c.Environment
+}
+
+// Refuses guarded operations with sandbox credentials in production and with other credentials in the sandbox.
+func (c *Client) checkEnvironment(op Operation) error {
+	env := c.Environment()
+	if env == EnvironmentCustom || !guardedOperations[op] {
+		return nil
+	}
+	sandbox := c.c.isSandboxLogin(basicAuthLogin(c.auth.Load().(string)))
+	if sandbox != (env == EnvironmentSandbox) {
+		kind := "production"
+		if sandbox {
+			kind = "sandbox"
+		}
+		return fmt.Errorf("%w: %s credentials in %s", ErrEnvironmentMismatch, kind, env)
+	}
+	return nil
+}
+
+func (c *Config) isSandboxLogin(login string) bool {
+	if login == DevLogin {
+		return true
+	}
+	for _, l := range c.SandboxLogins {
+		if l == login {
+			return true
+		}
+	}
+	return false
+}
+
+func basicAuthLogin(auth string) string {
+	b, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return ""
+	}
+	login := string(b)
+	if i := strings.IndexByte(login, ':'); i >= 0 {
+		login = login[:i]
+	}
+	return login
+}
+
+// Reports whether the gateway marked the payment as a test transaction.
+func (r *PaymentResponse) IsTest() bool {
+	return r.Details.StatusCode == StatusCodeTestTransaction
+}
+
+// Reports whether any transaction of the payment is marked as a test transaction.
+func (r *PaymentInfoResponse) IsTest() bool {
+	for _, d := range r.PurchaseDetails {
+		if PaymentStatusCode(d.StatusCode) == StatusCodeTestTransaction {
+			return true
+		}
+	}
+	for _, d := range r.ConfirmationDetails {
+		if PaymentStatusCode(d.StatusCode) == StatusCodeTestTransaction {
+			return true
+		}
+	}
+	for _, d := range r.CancellationDetails {
+		if PaymentStatusCode(d.StatusCode) == StatusCodeTestTransaction {
+			return true
+		}
+	}
+	for _, d := range r.RefundDetails {
+		if PaymentStatusCode(d.StatusCode) == StatusCodeTestTransaction {
+			return true
+		}
+	}
+	return false
+}
+
+// Test payments are kept out of the ledger.
+func (c *Client) isTestPayment(resp *PaymentResponse) bool {
+	return c.Environment() == EnvironmentSandbox || resp.IsTest()
+}
@@ -0,0 +1,66 @@
+package rozetkapay_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func TestNewConfigEnvironment(t *testing.T) {
+	if env := rozetkapay.NewConfig(rozetkapay.DevLogin, rozetkapay.DevPassword).Environment; env != rozetkapay.EnvironmentSandbox {
+		t.Fatalf("test login environment %s", env)
+	}
+	if env := rozetkapay.NewConfig("merchant", "secret").Environment; env != rozetkapay.EnvironmentProduction {
+		t.Fatalf("merchant login environment %s", env)
+	}
+}
+
+func TestEnvironmentGuardsConfirmAndRefund(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"p1"}`))
+	}))
+	defer gateway.Close()
+
+	tests := []struct {
+		name     string
+		cfg      *rozetkapay.Config
+		mismatch bool
+	}{
+		{"test login", rozetkapay.NewConfig(rozetkapay.DevLogin, rozetkapay.DevPassword), false},
+		{"merchant login", rozetkapay.NewConfig("merchant", "secret"), false},
+		{"test login in production", rozetkapay.NewConfig(rozetkapay.DevLogin, rozetkapay.DevPassword).SetEnvironment(rozetkapay.EnvironmentProduction), true},
+		{"merchant login in sandbox", rozetkapay.NewConfig("merchant", "secret").SetEnvironment(rozetkapay.EnvironmentSandbox), true},
+	}
+	for _, tt := range tests {
+		tt.cfg.API = gateway.URL + "/"
+		c := rozetkapay.NewClient(tt.cfg)
+		_, err := c.RefundPayment(&rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 1, Currency: "UAH"})
+		if mismatch := errors.Is(err, rozetkapay.ErrEnvironmentMismatch); mismatch != tt.mismatch {
+			t.Errorf("%s: refund error = %v", tt.name, err)
+		}
+	}
+}
+
+func TestPaymentInfoIsTest(t *testing.T) {
+	test := string(rozetkapay.StatusCodeTestTransaction)
+	tests := []struct {
+		name string
+		info rozetkapay.PaymentInfoResponse
+		want bool
+	}{
+		{"no transactions", rozetkapay.PaymentInfoResponse{}, false},
+		{"live purchase", rozetkapay.PaymentInfoResponse{PurchaseDetails: []rozetkapay.PurchaseDetail{{StatusCode: "transaction_successful"}}}, false},
+		{"test purchase", rozetkapay.PaymentInfoResponse{PurchaseDetails: []rozetkapay.PurchaseDetail{{StatusCode: test}}}, true},
+		{"test confirmation", rozetkapay.PaymentInfoResponse{ConfirmationDetails: []rozetkapay.ConfirmationDetail{{StatusCode: test}}}, true},
+		{"test cancellation", rozetkapay.PaymentInfoResponse{CancellationDetails: []rozetkapay.CancellationDetail{{StatusCode: test}}}, true},
+		{"test refund", rozetkapay.PaymentInfoResponse{RefundDetails: []rozetkapay.RefundDetail{{StatusCode: "transaction_successful"}, {StatusCode: test}}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.info.IsTest(); got != tt.want {
+			t.Errorf("%s: IsTest = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
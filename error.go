@@ -1,8 +1,7 @@
-package main
+package rozetkapay
 
 import (
 	"errors"
-	"fmt"
 )
 
 var (
@@ -15,8 +14,27 @@ type ErrorResponse struct {
 	Param     string            `json:"param"`
 	PaymentID string            `json:"payment_id"`
 	Type      string            `json:"type"`
+
+	RawFields `json:"-"`
+
+	// HTTP status of the response the error was received with.
+	HTTPStatus int `json:"-"`
+}
+
+func (e *ErrorResponse) Error() string {
+	return string(e.Code)
 }
 
+// Returns the error response as an error, which can be inspected with errors.As.
 func (e *ErrorResponse) ErrorCode() error {
-	return fmt.Errorf(string(e.Code))
+	return e
+}
+
+// Returns the status code of the gateway error response wrapped in err, if any.
+func ErrorStatusCode(err error) (PaymentStatusCode, bool) {
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp.Code, true
+	}
+	return "", false
 }
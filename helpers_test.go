@@ -0,0 +1,47 @@
+package rozetkapay_test
+
+import (
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+	"github.com/kabachoksolutions/rozetkapay/rozetkapaytest"
+)
+
+// Starts a fake gateway and a client pointed at it, both closed with the test.
+func newFakeClient(t *testing.T, opts ...rozetkapay.ClientOpts) (*rozetkapaytest.Server, *rozetkapay.Client) {
+	t.Helper()
+	srv := rozetkapaytest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv, rozetkapay.NewClient(srv.Config(), opts...)
+}
+
+// Creates a one-step card payment, purchased and confirmed at once unless the token has a scenario.
+func createDirectPayment(t *testing.T, c *rozetkapay.Client, externalID string, amount float64, token string) *rozetkapay.PaymentResponse {
+	t.Helper()
+	resp, err := c.CreatePayment(&rozetkapay.CreatePaymentSchema{
+		ExternalID: externalID,
+		Amount:     amount,
+		Currency:   "UAH",
+		Mode:       rozetkapay.PaymentModeDirect,
+		Confirm:    true,
+		Customer: &rozetkapay.CustomerData{
+			PaymentMethod: rozetkapay.PaymentMethod{
+				Type:    rozetkapay.PaymentMethodTypeCCToken,
+				CCToken: rozetkapay.CCToken{Token: token},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create payment %s: %v", externalID, err)
+	}
+	return resp
+}
+
+func refundPayment(t *testing.T, c *rozetkapay.Client, externalID string, amount float64) *rozetkapay.PaymentResponse {
+	t.Helper()
+	resp, err := c.RefundPayment(&rozetkapay.RefundPaymentSchema{ExternalID: externalID, Amount: amount, Currency: "UAH"})
+	if err != nil {
+		t.Fatalf("refund payment %s: %v", externalID, err)
+	}
+	return resp
+}
@@ -0,0 +1,331 @@
+package rozetkapay
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type LedgerOperation string
+
+const (
+	LedgerOperationCreate  LedgerOperation = "create"
+	LedgerOperationConfirm LedgerOperation = "confirm"
+	LedgerOperationCancel  LedgerOperation = "cancel"
+	LedgerOperationRefund  LedgerOperation = "refund"
+
+	// A callback for a transaction the ledger has not seen before.
+	LedgerOperationUnknown LedgerOperation = "unknown"
+)
+
+type LedgerSource string
+
+const (
+	LedgerSourceClient   LedgerSource = "client"
+	LedgerSourceCallback LedgerSource = "callback"
+)
+
+type LedgerEntry struct {
+	ID            string            `json:"id"`
+	Time          time.Time         `json:"time"`
+	Source        LedgerSource      `json:"source"`
+	Operation     LedgerOperation   `json:"operation"`
+	ExternalID    string            `json:"external_id"`
+	PaymentID     string            `json:"payment_id,omitempty"`
+	TransactionID string            `json:"transaction_id,omitempty"`
+	Amount        Money             `json:"amount"`
+	Fee           Money             `json:"fee"`
+	Status        PaymentStatus     `json:"status"`
+	StatusCode    PaymentStatusCode `json:"status_code,omitempty"`
+}
+
+type LedgerFilter struct {
+	// Only entries of the order, all orders if empty.
+	ExternalID string
+
+	// Only entries recorded within [From, To), unbounded if zero.
+	From time.Time
+	To   time.Time
+}
+
+func (f LedgerFilter) match(e LedgerEntry) bool {
+	if f.ExternalID != "" && e.ExternalID != f.ExternalID {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// LedgerStore persists ledger entries. Implementations must be safe for concurrent use
+// and return entries in the order they were appended.
+type LedgerStore interface {
+	Append(entry LedgerEntry) error
+	Entries(filter LedgerFilter) ([]LedgerEntry, error)
+}
+
+// MemoryLedgerStore keeps entries in memory.
+type MemoryLedgerStore struct {
+	mu      sync.Mutex
+	entries []LedgerEntry
+}
+
+func NewMemoryLedgerStore() *MemoryLedgerStore {
+	return &MemoryLedgerStore{}
+}
+
+func (s *MemoryLedgerStore) Append(entry LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *MemoryLedgerStore) Entries(filter LedgerFilter) ([]LedgerEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []LedgerEntry
+	for _, e := range s.entries {
+		if filter.match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// FileLedgerStore appends entries as JSON lines to a file and keeps them in memory for queries.
+type FileLedgerStore struct {
+	mem  MemoryLedgerStore
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Opens the ledger file, creating it if needed, and loads the entries recorded before.
+func NewFileLedgerStore(path string) (*FileLedgerStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileLedgerStore{file: f}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e LedgerEntry
+		// A torn last line from a crash is skipped.
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		s.mem.entries = append(s.mem.entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileLedgerStore) Append(entry LedgerEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	return s.mem.Append(entry)
+}
+
+func (s *FileLedgerStore) Entries(filter LedgerFilter) ([]LedgerEntry, error) {
+	return s.mem.Entries(filter)
+}
+
+func (s *FileLedgerStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Ledger mirrors the state of payments from the operations performed by the client
+// and the callbacks it received.
+type Ledger struct {
+	store LedgerStore
+}
+
+func NewLedger(store LedgerStore) *Ledger {
+	return &Ledger{store: store}
+}
+
+func (l *Ledger) Record(entry LedgerEntry) error {
+	if entry.ID == "" {
+		entry.ID = randomHex(16)
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	return l.store.Append(entry)
+}
+
+func (l *Ledger) Entries(filter LedgerFilter) ([]LedgerEntry, error) {
+	return l.store.Entries(filter)
+}
+
+// Records the outcome of a payment operation or callback.
+func (l *Ledger) recordPayment(source LedgerSource, op LedgerOperation, resp *PaymentResponse) error {
+	d := resp.Details
+	amount, err := ParseMoney(d.Amount, d.Currency)
+	if err != nil {
+		return err
+	}
+	fee, err := ParseMoney(d.Fee.Amount, firstNonEmpty(d.Fee.Currency, d.Currency))
+	if err != nil {
+		return err
+	}
+
+	if source == LedgerSourceCallback && op == "" {
+		if op, err = l.callbackOperation(resp.ExternalID, d.TransactionID); err != nil {
+			return err
+		}
+	}
+
+	return l.Record(LedgerEntry{
+		Source:        source,
+		Operation:     op,
+		ExternalID:    resp.ExternalID,
+		PaymentID:     firstNonEmpty(d.PaymentID, resp.ID),
+		TransactionID: d.TransactionID,
+		Amount:        amount,
+		Fee:           fee,
+		Status:        d.Status,
+		StatusCode:    d.StatusCode,
+	})
+}
+
+// Returns the orders with entries recorded within [from, to), sorted.
+func (l *Ledger) ExternalIDs(from, to time.Time) ([]string, error) {
+	entries, err := l.store.Entries(LedgerFilter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, e := range entries {
+		if !seen[e.ExternalID] {
+			seen[e.ExternalID] = true
+			ids = append(ids, e.ExternalID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Callbacks parsed without their operation take it from the entry of the same transaction.
+// A callback of an order without entries is considered to be its creation.
+func (l *Ledger) callbackOperation(externalID, transactionID string) (LedgerOperation, error) {
+	entries, err := l.store.Entries(LedgerFilter{ExternalID: externalID})
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return LedgerOperationCreate, nil
+	}
+	for _, e := range entries {
+		if transactionID != "" && e.TransactionID == transactionID && e.Operation != LedgerOperationUnknown {
+			return e.Operation, nil
+		}
+	}
+	return LedgerOperationUnknown, nil
+}
+
+// Collapses entries of the same transaction to the latest one.
+func latestTransactions(entries []LedgerEntry) []LedgerEntry {
+	index := map[string]int{}
+	var out []LedgerEntry
+	for _, e := range entries {
+		key := e.TransactionID
+		if key == "" {
+			key = e.ID
+		}
+		if i, ok := index[key]; ok {
+			if e.Operation == LedgerOperationUnknown {
+				e.Operation = out[i].Operation
+			}
+			out[i] = e
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, e)
+	}
+	return out
+}
+
+// Returns the amount held or captured from the customer for the order:
+// successful purchases less successful cancellations and refunds.
+func (l *Ledger) Balance(externalID string) (Money, error) {
+	entries, err := l.store.Entries(LedgerFilter{ExternalID: externalID})
+	if err != nil {
+		return Money{}, err
+	}
+	var balance Money
+	for _, e := range latestTransactions(entries) {
+		if e.Status != PaymentStatusSuccess {
+			continue
+		}
+		if balance.Currency == "" {
+			balance.Currency = e.Amount.Currency
+		}
+		switch e.Operation {
+		case LedgerOperationCreate:
+			balance = balance.Add(e.Amount)
+		case LedgerOperationCancel, LedgerOperationRefund:
+			balance = balance.Sub(e.Amount)
+		}
+	}
+	return balance, nil
+}
+
+// Returns fees of the successful transactions recorded on the day, per currency.
+// The day is taken in the location of the given time.
+func (l *Ledger) FeesOn(day time.Time) (map[string]Money, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	entries, err := l.store.Entries(LedgerFilter{From: from, To: from.AddDate(0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+	fees := map[string]Money{}
+	for _, e := range latestTransactions(entries) {
+		if e.Status != PaymentStatusSuccess || e.Fee.IsZero() {
+			continue
+		}
+		fee := fees[e.Fee.Currency]
+		fee.Currency = e.Fee.Currency
+		fees[e.Fee.Currency] = fee.Add(e.Fee)
+	}
+	return fees, nil
+}
+
+// Returns refunds which have not reached a final status yet.
+func (l *Ledger) PendingRefunds() ([]LedgerEntry, error) {
+	entries, err := l.store.Entries(LedgerFilter{})
+	if err != nil {
+		return nil, err
+	}
+	var pending []LedgerEntry
+	for _, e := range latestTransactions(entries) {
+		if e.Operation == LedgerOperationRefund && (e.Status == PaymentStatusPending || e.Status == PaymentStatusInit) {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
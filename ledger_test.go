@@ -0,0 +1,165 @@
+package rozetkapay_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func uah(amount int64) rozetkapay.Money {
+	return rozetkapay.Money{Amount: amount, Currency: "UAH"}
+}
+
+func record(t *testing.T, l *rozetkapay.Ledger, entries ...rozetkapay.LedgerEntry) {
+	t.Helper()
+	for _, e := range entries {
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLedgerBalance(t *testing.T) {
+	l := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	record(t, l,
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationCreate, ExternalID: "order-1", TransactionID: "tx-1", Amount: uah(10000), Status: rozetkapay.PaymentStatusSuccess},
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationRefund, ExternalID: "order-1", TransactionID: "tx-2", Amount: uah(4000), Status: rozetkapay.PaymentStatusPending},
+		// The callback of the refund, recorded without its operation, settles it.
+		rozetkapay.LedgerEntry{Source: rozetkapay.LedgerSourceCallback, Operation: rozetkapay.LedgerOperationUnknown, ExternalID: "order-1", TransactionID: "tx-2", Amount: uah(4000), Status: rozetkapay.PaymentStatusSuccess},
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationRefund, ExternalID: "order-1", TransactionID: "tx-3", Amount: uah(1000), Status: rozetkapay.PaymentStatusFailure},
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationCreate, ExternalID: "order-2", TransactionID: "tx-4", Amount: uah(500), Status: rozetkapay.PaymentStatusSuccess},
+	)
+
+	balance, err := l.Balance("order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != uah(6000) {
+		t.Fatalf("balance = %s, want 60.00 UAH", balance)
+	}
+	pending, err := l.PendingRefunds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("settled refund still pending: %+v", pending)
+	}
+}
+
+func TestLedgerPendingRefunds(t *testing.T) {
+	l := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	record(t, l,
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationRefund, ExternalID: "order-1", TransactionID: "tx-1", Amount: uah(100), Status: rozetkapay.PaymentStatusPending},
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationRefund, ExternalID: "order-2", TransactionID: "tx-2", Amount: uah(100), Status: rozetkapay.PaymentStatusSuccess},
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationCreate, ExternalID: "order-3", TransactionID: "tx-3", Amount: uah(100), Status: rozetkapay.PaymentStatusPending},
+	)
+	pending, err := l.PendingRefunds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].TransactionID != "tx-1" {
+		t.Fatalf("pending refunds %+v", pending)
+	}
+}
+
+func TestLedgerFeesOn(t *testing.T) {
+	l := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	record(t, l,
+		rozetkapay.LedgerEntry{Time: day.Add(time.Hour), ExternalID: "order-1", TransactionID: "tx-1", Fee: uah(150), Status: rozetkapay.PaymentStatusSuccess},
+		rozetkapay.LedgerEntry{Time: day.Add(2 * time.Hour), ExternalID: "order-2", TransactionID: "tx-2", Fee: uah(50), Status: rozetkapay.PaymentStatusSuccess},
+		rozetkapay.LedgerEntry{Time: day.Add(3 * time.Hour), ExternalID: "order-3", TransactionID: "tx-3", Fee: rozetkapay.Money{Amount: 10, Currency: "USD"}, Status: rozetkapay.PaymentStatusSuccess},
+		rozetkapay.LedgerEntry{Time: day.Add(4 * time.Hour), ExternalID: "order-4", TransactionID: "tx-4", Fee: uah(1000), Status: rozetkapay.PaymentStatusFailure},
+		rozetkapay.LedgerEntry{Time: day.AddDate(0, 0, 1), ExternalID: "order-5", TransactionID: "tx-5", Fee: uah(1000), Status: rozetkapay.PaymentStatusSuccess},
+	)
+
+	fees, err := l.FeesOn(day.Add(12 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fees) != 2 || fees["UAH"] != uah(200) || fees["USD"].Amount != 10 {
+		t.Fatalf("fees %v", fees)
+	}
+
+	ids, err := l.ExternalIDs(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[order-1 order-2 order-3 order-4]" {
+		t.Fatalf("external ids %v", ids)
+	}
+}
+
+func TestFileLedgerStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	store, err := rozetkapay.NewFileLedgerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record(t, rozetkapay.NewLedger(store),
+		rozetkapay.LedgerEntry{Operation: rozetkapay.LedgerOperationCreate, ExternalID: "order-1", TransactionID: "tx-1", Amount: uah(10000), Status: rozetkapay.PaymentStatusSuccess},
+	)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A torn line left by a crash is skipped on load.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"torn","operation":"ref`)
+	f.Close()
+
+	store, err = rozetkapay.NewFileLedgerStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	entries, err := store.Entries(rozetkapay.LedgerFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID == "" || entries[0].Amount != uah(10000) {
+		t.Fatalf("entries %+v", entries)
+	}
+}
+
+func TestClientRecordsLedger(t *testing.T) {
+	ledger := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	_, c := newFakeClient(t, rozetkapay.WithLedger(ledger))
+
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+	refundPayment(t, c, "order-1", 40)
+
+	entries, err := ledger.Entries(rozetkapay.LedgerFilter{ExternalID: "order-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Operation != rozetkapay.LedgerOperationCreate || entries[1].Operation != rozetkapay.LedgerOperationRefund {
+		t.Fatalf("entries %+v", entries)
+	}
+	balance, err := ledger.Balance("order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Decimal() != "60.00" {
+		t.Fatalf("balance = %s, want 60.00", balance.Decimal())
+	}
+}
+
+func TestSandboxPaymentsNotRecorded(t *testing.T) {
+	ledger := rozetkapay.NewLedger(rozetkapay.NewMemoryLedgerStore())
+	srv, _ := newFakeClient(t)
+	cfg := srv.Config().SetEnvironment(rozetkapay.EnvironmentSandbox)
+	c := rozetkapay.NewClient(cfg, rozetkapay.WithLedger(ledger))
+
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+	if entries, _ := ledger.Entries(rozetkapay.LedgerFilter{}); len(entries) != 0 {
+		t.Fatalf("sandbox payment recorded: %+v", entries)
+	}
+}
@@ -0,0 +1,240 @@
+package rozetkapay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RequestOutcome string
+
+const (
+	// The gateway accepted the request and the response was decoded.
+	RequestOutcomeSuccess RequestOutcome = "success"
+
+	// The gateway responded with an error or with a body that could not be decoded.
+	RequestOutcomeError RequestOutcome = "error"
+
+	// The request did not reach the gateway or the response was not received.
+	RequestOutcomeTransportError RequestOutcome = "transport_error"
+)
+
+// RequestMetrics describes a single attempt of a gateway call.
+type RequestMetrics struct {
+	Operation Operation
+	Outcome   RequestOutcome
+
+	// HTTP status of the response, zero if no response was received.
+	HTTPStatus int
+
+	// Status code from the error response or from the payment details of a successful one.
+	StatusCode PaymentStatusCode
+
+	// Attempt number starting from 1.
+	Attempt  int
+	Duration time.Duration
+	Err      error
+}
+
+// MetricsRecorder is called by the client after every gateway call attempt.
+// Implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	ObserveRequest(m RequestMetrics)
+}
+
+// DefaultDurationBuckets are the histogram buckets (in seconds) used by InMemoryMetrics
+// when none are provided.
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type requestCounterKey struct {
+	operation  Operation
+	outcome    RequestOutcome
+	httpStatus int
+	statusCode PaymentStatusCode
+}
+
+type durationHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// InMemoryMetrics is a MetricsRecorder that keeps counters and latency histograms in memory
+// and exposes them in the Prometheus text exposition format.
+type InMemoryMetrics struct {
+	mu        sync.Mutex
+	buckets   []float64
+	requests  map[requestCounterKey]uint64
+	retries   map[Operation]uint64
+	durations map[Operation]*durationHistogram
+}
+
+func NewInMemoryMetrics(buckets ...float64) *InMemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &InMemoryMetrics{
+		buckets:   b,
+		requests:  map[requestCounterKey]uint64{},
+		retries:   map[Operation]uint64{},
+		durations: map[Operation]*durationHistogram{},
+	}
+}
+
+func (m *InMemoryMetrics) ObserveRequest(r RequestMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestCounterKey{r.Operation, r.Outcome, r.HTTPStatus, r.StatusCode}]++
+	if r.Attempt > 1 {
+		m.retries[r.Operation]++
+	}
+
+	h, ok := m.durations[r.Operation]
+	if !ok {
+		h = &durationHistogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[r.Operation] = h
+	}
+	seconds := r.Duration.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Returns the number of recorded attempts of the operation with the given outcome.
+func (m *InMemoryMetrics) Count(operation Operation, outcome RequestOutcome) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n uint64
+	for k, v := range m.requests {
+		if k.operation == operation && k.outcome == outcome {
+			n += v
+		}
+	}
+	return n
+}
+
+// Returns the number of recorded attempts of the operation that ended with the status code.
+func (m *InMemoryMetrics) CountStatusCode(operation Operation, code PaymentStatusCode) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n uint64
+	for k, v := range m.requests {
+		if k.operation == operation && k.statusCode == code {
+			n += v
+		}
+	}
+	return n
+}
+
+// Writes all metrics in the Prometheus text exposition format.
+func (m *InMemoryMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var buf bytes.Buffer
+
+	keys := make([]requestCounterKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		if a.outcome != b.outcome {
+			return a.outcome < b.outcome
+		}
+		if a.httpStatus != b.httpStatus {
+			return a.httpStatus < b.httpStatus
+		}
+		return a.statusCode < b.statusCode
+	})
+	buf.WriteString("# HELP rozetkapay_requests_total Total number of RozetkaPay gateway call attempts.\n")
+	buf.WriteString("# TYPE rozetkapay_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(
+			&buf, "rozetkapay_requests_total{operation=%s,outcome=%s,http_status=%s,status_code=%s} %d\n",
+			promLabel(string(k.operation)),
+			promLabel(string(k.outcome)),
+			promLabel(strconv.Itoa(k.httpStatus)),
+			promLabel(string(k.statusCode)),
+			m.requests[k],
+		)
+	}
+
+	buf.WriteString("# HELP rozetkapay_retries_total Total number of repeated RozetkaPay gateway call attempts.\n")
+	buf.WriteString("# TYPE rozetkapay_retries_total counter\n")
+	for _, op := range sortedOperations(m.retries) {
+		fmt.Fprintf(&buf, "rozetkapay_retries_total{operation=%s} %d\n", promLabel(string(op)), m.retries[op])
+	}
+
+	ops := make([]Operation, 0, len(m.durations))
+	for op := range m.durations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	buf.WriteString("# HELP rozetkapay_request_duration_seconds Duration of RozetkaPay gateway call attempts.\n")
+	buf.WriteString("# TYPE rozetkapay_request_duration_seconds histogram\n")
+	for _, op := range ops {
+		h := m.durations[op]
+		label := promLabel(string(op))
+		for i, le := range m.buckets {
+			fmt.Fprintf(
+				&buf, "rozetkapay_request_duration_seconds_bucket{operation=%s,le=%s} %d\n",
+				label, promLabel(promFloat(le)), h.counts[i],
+			)
+		}
+		fmt.Fprintf(&buf, "rozetkapay_request_duration_seconds_bucket{operation=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&buf, "rozetkapay_request_duration_seconds_sum{operation=%s} %s\n", label, promFloat(h.sum))
+		fmt.Fprintf(&buf, "rozetkapay_request_duration_seconds_count{operation=%s} %d\n", label, h.count)
+	}
+
+	return buf.WriteTo(w)
+}
+
+func (m *InMemoryMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		log.Printf("[RozetkaPay] Error --- type: %s, message: %s\n", "metrics", err)
+	}
+}
+
+func sortedOperations(m map[Operation]uint64) []Operation {
+	ops := make([]Operation, 0, len(m))
+	for op := range m {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i] < ops[j] })
+	return ops
+}
+
+var promLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabel(v string) string {
+	return `"` + promLabelReplacer.Replace(v) + `"`
+}
+
+func promFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,66 @@
+package rozetkapay_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func TestInMemoryMetrics(t *testing.T) {
+	m := rozetkapay.NewInMemoryMetrics(1, 0.1)
+	op := rozetkapay.OperationRefundPayment
+	m.ObserveRequest(rozetkapay.RequestMetrics{Operation: op, Outcome: rozetkapay.RequestOutcomeSuccess, HTTPStatus: 200, Attempt: 1, Duration: 50 * time.Millisecond})
+	m.ObserveRequest(rozetkapay.RequestMetrics{
+		Operation: op, Outcome: rozetkapay.RequestOutcomeError, HTTPStatus: 400,
+		StatusCode: rozetkapay.StatusCodeTransactionDeclined, Attempt: 2, Duration: 500 * time.Millisecond,
+	})
+	m.ObserveRequest(rozetkapay.RequestMetrics{Operation: op, Outcome: rozetkapay.RequestOutcomeTransportError, Attempt: 3, Duration: 2 * time.Second, Err: errors.New("reset")})
+
+	if n := m.Count(op, rozetkapay.RequestOutcomeSuccess); n != 1 {
+		t.Fatalf("success count %d", n)
+	}
+	if n := m.CountStatusCode(op, rozetkapay.StatusCodeTransactionDeclined); n != 1 {
+		t.Fatalf("declined count %d", n)
+	}
+	if n := m.Count(rozetkapay.OperationCreatePayment, rozetkapay.RequestOutcomeSuccess); n != 0 {
+		t.Fatalf("other operation count %d", n)
+	}
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`rozetkapay_requests_total{operation="refund_payment",outcome="error",http_status="400",status_code="transaction_declined"} 1`,
+		`rozetkapay_retries_total{operation="refund_payment"} 2`,
+		`rozetkapay_request_duration_seconds_bucket{operation="refund_payment",le="0.1"} 1`,
+		`rozetkapay_request_duration_seconds_bucket{operation="refund_payment",le="1"} 2`,
+		`rozetkapay_request_duration_seconds_bucket{operation="refund_payment",le="+Inf"} 3`,
+		`rozetkapay_request_duration_seconds_sum{operation="refund_payment"} 2.55`,
+		`rozetkapay_request_duration_seconds_count{operation="refund_payment"} 3`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, b.String())
+		}
+	}
+}
+
+func TestClientObservesRequests(t *testing.T) {
+	m := rozetkapay.NewInMemoryMetrics()
+	_, c := newFakeClient(t, rozetkapay.WithMetricsRecorder(m))
+
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+	if _, err := c.RefundPayment(&rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 500, Currency: "UAH"}); err == nil {
+		t.Fatal("refund above the payment amount succeeded")
+	}
+
+	if n := m.Count(rozetkapay.OperationCreatePayment, rozetkapay.RequestOutcomeSuccess); n != 1 {
+		t.Fatalf("create successes %d", n)
+	}
+	if n := m.Count(rozetkapay.OperationRefundPayment, rozetkapay.RequestOutcomeError); n != 1 {
+		t.Fatalf("refund errors %d", n)
+	}
+}
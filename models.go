@@ -1,6 +1,9 @@
-package main
+package rozetkapay
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type PaymentMode string
 
@@ -251,8 +254,34 @@ type (
 	}
 )
 
+// Encodes only the payment method objects that are set, omitempty has no effect on structs.
+func (m PaymentMethod) MarshalJSON() ([]byte, error) {
+	out := struct {
+		ApplePay  *ApplePay         `json:"apple_pay,omitempty"`
+		CCToken   *CCToken          `json:"cc_token,omitempty"`
+		GooglePay *GooglePay        `json:"google_pay,omitempty"`
+		Type      PaymentMethodType `json:"type,omitempty"`
+		Wallet    *Wallet           `json:"wallet,omitempty"`
+	}{Type: m.Type}
+	if m.ApplePay != (ApplePay{}) {
+		out.ApplePay = &m.ApplePay
+	}
+	if m.CCToken != (CCToken{}) {
+		out.CCToken = &m.CCToken
+	}
+	if m.GooglePay != (GooglePay{}) {
+		out.GooglePay = &m.GooglePay
+	}
+	if m.Wallet != (Wallet{}) {
+		out.Wallet = &m.Wallet
+	}
+	return json.Marshal(out)
+}
+
 type (
 	PaymentResponse struct {
+		RawFields `json:"-"`
+
 		ID string `json:"id"`
 
 		// Block that will be filled in if the parameters are "action_required": True.
@@ -279,29 +308,24 @@ type (
 	}
 
 	PaymentResponseDetails struct {
-		Amount            string                           `json:"amount"`
-		BillingOrderID    string                           `json:"billing_order_id"`
-		CreatedAt         time.Time                        `json:"created_at"`
-		Currency          string                           `json:"currency"`
-		Description       string                           `json:"description"`
-		GatewayOrderID    string                           `json:"gateway_order_id"`
-		Payload           string                           `json:"payload"`
-		PaymentID         string                           `json:"payment_id"`
-		ProcessedAt       time.Time                        `json:"processed_at"`
-		Properties        PaymentResponseDetailsProperties `json:"properties"`
-		RRN               string                           `json:"rrn"`
-		Status            PaymentStatus                    `json:"status"`
-		StatusCode        PaymentStatusCode                `json:"status_code"`
-		StatusDescription string                           `json:"status_description"`
-		TransactionID     string                           `json:"transaction_id"`
-		AuthCode          string                           `json:"auth_code"`
-		Fee               PaymentResponseDetailsFee        `json:"fee"`
-		TerminalName      string                           `json:"terminal_name"`
-	}
-
-	PaymentResponseDetailsProperties struct {
-		Property1 string `json:"property1"`
-		Property2 string `json:"property2"`
+		Amount            string                    `json:"amount"`
+		BillingOrderID    string                    `json:"billing_order_id"`
+		CreatedAt         time.Time                 `json:"created_at"`
+		Currency          string                    `json:"currency"`
+		Description       string                    `json:"description"`
+		GatewayOrderID    string                    `json:"gateway_order_id"`
+		Payload           string                    `json:"payload"`
+		PaymentID         string                    `json:"payment_id"`
+		ProcessedAt       time.Time                 `json:"processed_at"`
+		Properties        Properties                `json:"properties"`
+		RRN               string                    `json:"rrn"`
+		Status            PaymentStatus             `json:"status"`
+		StatusCode        PaymentStatusCode         `json:"status_code"`
+		StatusDescription string                    `json:"status_description"`
+		TransactionID     string                    `json:"transaction_id"`
+		AuthCode          string                    `json:"auth_code"`
+		Fee               PaymentResponseDetailsFee `json:"fee"`
+		TerminalName      string                    `json:"terminal_name"`
 	}
 
 	PaymentResponseDetailsFee struct {
@@ -359,6 +383,19 @@ type (
 	}
 )
 
+// Encodes the customer without the payment method when none is set.
+func (c CustomerData) MarshalJSON() ([]byte, error) {
+	type customer CustomerData
+	out := struct {
+		customer
+		PaymentMethod *PaymentMethod `json:"payment_method,omitempty"`
+	}{customer: customer(c)}
+	if c.PaymentMethod != (PaymentMethod{}) {
+		out.PaymentMethod = &c.PaymentMethod
+	}
+	return json.Marshal(out)
+}
+
 type CreatePaymentSchema struct {
 	// Amount of the order.
 	Amount float64 `json:"amount"`
@@ -394,7 +431,7 @@ type CreatePaymentSchema struct {
 	Payload string `json:"payload,omitempty"`
 
 	// Payer information block.
-	Customer *CustomerData `json:"customer"`
+	Customer *CustomerData `json:"customer,omitempty"`
 
 	// List of products/services in the order.
 	Products []Product `json:"products,omitempty"`
@@ -403,7 +440,7 @@ type CreatePaymentSchema struct {
 	Recipient *Recipient `json:"recipient,omitempty"`
 
 	// Dictionary in key:value format for additional parameters.
-	Properties map[string]string `json:"properties,omitempty"`
+	Properties Properties `json:"properties,omitempty"`
 }
 
 // Confirm payment
@@ -447,90 +484,92 @@ type (
 	}
 
 	CancellationDetail struct {
-		Amount            string            `json:"amount"`
-		BillingOrderID    string            `json:"billing_order_id"`
-		CreatedAt         time.Time         `json:"created_at"`
-		Currency          string            `json:"currency"`
-		Description       string            `json:"description"`
-		GatewayOrderID    string            `json:"gateway_order_id"`
-		Payload           string            `json:"payload"`
-		PaymentID         string            `json:"payment_id"`
-		ProcessedAt       time.Time         `json:"processed_at"`
-		Properties        map[string]string `json:"properties"`
-		RRN               string            `json:"rrn"`
-		Status            string            `json:"status"`
-		StatusCode        string            `json:"status_code"`
-		StatusDescription string            `json:"status_description"`
-		TransactionID     string            `json:"transaction_id"`
-		AuthCode          string            `json:"auth_code"`
-		Fee               Fee               `json:"fee"`
-		TerminalName      string            `json:"terminal_name"`
+		Amount            string     `json:"amount"`
+		BillingOrderID    string     `json:"billing_order_id"`
+		CreatedAt         time.Time  `json:"created_at"`
+		Currency          string     `json:"currency"`
+		Description       string     `json:"description"`
+		GatewayOrderID    string     `json:"gateway_order_id"`
+		Payload           string     `json:"payload"`
+		PaymentID         string     `json:"payment_id"`
+		ProcessedAt       time.Time  `json:"processed_at"`
+		Properties        Properties `json:"properties"`
+		RRN               string     `json:"rrn"`
+		Status            string     `json:"status"`
+		StatusCode        string     `json:"status_code"`
+		StatusDescription string     `json:"status_description"`
+		TransactionID     string     `json:"transaction_id"`
+		AuthCode          string     `json:"auth_code"`
+		Fee               Fee        `json:"fee"`
+		TerminalName      string     `json:"terminal_name"`
 	}
 
 	ConfirmationDetail struct {
-		Amount            string            `json:"amount"`
-		BillingOrderID    string            `json:"billing_order_id"`
-		CreatedAt         time.Time         `json:"created_at"`
-		Currency          string            `json:"currency"`
-		Description       string            `json:"description"`
-		GatewayOrderID    string            `json:"gateway_order_id"`
-		Payload           string            `json:"payload"`
-		PaymentID         string            `json:"payment_id"`
-		ProcessedAt       time.Time         `json:"processed_at"`
-		Properties        map[string]string `json:"properties"`
-		RRN               string            `json:"rrn"`
-		Status            string            `json:"status"`
-		StatusCode        string            `json:"status_code"`
-		StatusDescription string            `json:"status_description"`
-		TransactionID     string            `json:"transaction_id"`
-		AuthCode          string            `json:"auth_code"`
-		Fee               Fee               `json:"fee"`
-		TerminalName      string            `json:"terminal_name"`
+		Amount            string     `json:"amount"`
+		BillingOrderID    string     `json:"billing_order_id"`
+		CreatedAt         time.Time  `json:"created_at"`
+		Currency          string     `json:"currency"`
+		Description       string     `json:"description"`
+		GatewayOrderID    string     `json:"gateway_order_id"`
+		Payload           string     `json:"payload"`
+		PaymentID         string     `json:"payment_id"`
+		ProcessedAt       time.Time  `json:"processed_at"`
+		Properties        Properties `json:"properties"`
+		RRN               string     `json:"rrn"`
+		Status            string     `json:"status"`
+		StatusCode        string     `json:"status_code"`
+		StatusDescription string     `json:"status_description"`
+		TransactionID     string     `json:"transaction_id"`
+		AuthCode          string     `json:"auth_code"`
+		Fee               Fee        `json:"fee"`
+		TerminalName      string     `json:"terminal_name"`
 	}
 
 	PurchaseDetail struct {
-		Amount            string            `json:"amount"`
-		BillingOrderID    string            `json:"billing_order_id"`
-		CreatedAt         time.Time         `json:"created_at"`
-		Currency          string            `json:"currency"`
-		Description       string            `json:"description"`
-		GatewayOrderID    string            `json:"gateway_order_id"`
-		Payload           string            `json:"payload"`
-		PaymentID         string            `json:"payment_id"`
-		ProcessedAt       time.Time         `json:"processed_at"`
-		Properties        map[string]string `json:"properties"`
-		RRN               string            `json:"rrn"`
-		Status            string            `json:"status"`
-		StatusCode        string            `json:"status_code"`
-		StatusDescription string            `json:"status_description"`
-		TransactionID     string            `json:"transaction_id"`
-		AuthCode          string            `json:"auth_code"`
-		Fee               Fee               `json:"fee"`
-		TerminalName      string            `json:"terminal_name"`
+		Amount            string     `json:"amount"`
+		BillingOrderID    string     `json:"billing_order_id"`
+		CreatedAt         time.Time  `json:"created_at"`
+		Currency          string     `json:"currency"`
+		Description       string     `json:"description"`
+		GatewayOrderID    string     `json:"gateway_order_id"`
+		Payload           string     `json:"payload"`
+		PaymentID         string     `json:"payment_id"`
+		ProcessedAt       time.Time  `json:"processed_at"`
+		Properties        Properties `json:"properties"`
+		RRN               string     `json:"rrn"`
+		Status            string     `json:"status"`
+		StatusCode        string     `json:"status_code"`
+		StatusDescription string     `json:"status_description"`
+		TransactionID     string     `json:"transaction_id"`
+		AuthCode          string     `json:"auth_code"`
+		Fee               Fee        `json:"fee"`
+		TerminalName      string     `json:"terminal_name"`
 	}
 
 	RefundDetail struct {
-		Amount            string            `json:"amount"`
-		BillingOrderID    string            `json:"billing_order_id"`
-		CreatedAt         time.Time         `json:"created_at"`
-		Currency          string            `json:"currency"`
-		Description       string            `json:"description"`
-		GatewayOrderID    string            `json:"gateway_order_id"`
-		Payload           string            `json:"payload"`
-		PaymentID         string            `json:"payment_id"`
-		ProcessedAt       time.Time         `json:"processed_at"`
-		Properties        map[string]string `json:"properties"`
-		RRN               string            `json:"rrn"`
-		Status            string            `json:"status"`
-		StatusCode        string            `json:"status_code"`
-		StatusDescription string            `json:"status_description"`
-		TransactionID     string            `json:"transaction_id"`
-		AuthCode          string            `json:"auth_code"`
-		Fee               Fee               `json:"fee"`
-		TerminalName      string            `json:"terminal_name"`
+		Amount            string     `json:"amount"`
+		BillingOrderID    string     `json:"billing_order_id"`
+		CreatedAt         time.Time  `json:"created_at"`
+		Currency          string     `json:"currency"`
+		Description       string     `json:"description"`
+		GatewayOrderID    string     `json:"gateway_order_id"`
+		Payload           string     `json:"payload"`
+		PaymentID         string     `json:"payment_id"`
+		ProcessedAt       time.Time  `json:"processed_at"`
+		Properties        Properties `json:"properties"`
+		RRN               string     `json:"rrn"`
+		Status            string     `json:"status"`
+		StatusCode        string     `json:"status_code"`
+		StatusDescription string     `json:"status_description"`
+		TransactionID     string     `json:"transaction_id"`
+		AuthCode          string     `json:"auth_code"`
+		Fee               Fee        `json:"fee"`
+		TerminalName      string     `json:"terminal_name"`
 	}
 
 	PaymentInfoResponse struct {
+		RawFields `json:"-"`
+
 		Action              PaymentUserAction    `json:"action"`
 		ActionRequired      bool                 `json:"action_required"`
 		Amount              string               `json:"amount"`
@@ -560,6 +599,9 @@ type CallbackResendOperation string
 
 const (
 	CallbackResendOperationPayment CallbackResendOperation = "payment"
+	CallbackResendOperationConfirm CallbackResendOperation = "confirm"
+	CallbackResendOperationCancel  CallbackResendOperation = "cancel"
+	CallbackResendOperationRefund  CallbackResendOperation = "refund"
 )
 
 type PaymentCallbackResendSchema struct {
@@ -583,12 +625,27 @@ type (
 	}
 
 	AddWalletCustomerResponse struct {
+		RawFields `json:"-"`
+
 		Action         PaymentUserAction              `json:"action"`
 		ActionRequired bool                           `json:"action_required"`
 		CreatedAt      time.Time                      `json:"created_at"`
 		PaymentMethod  AddWalletCustomerPaymentMethod `json:"payment_method"`
 		Status         PaymentStatus                  `json:"status"`
 	}
+
+	// Callback with the result of adding a payment method to the wallet.
+	WalletCallback struct {
+		RawFields `json:"-"`
+
+		// Unique payer number of the partner.
+		ExternalID        string                         `json:"external_id"`
+		CreatedAt         time.Time                      `json:"created_at"`
+		PaymentMethod     AddWalletCustomerPaymentMethod `json:"payment_method"`
+		Status            PaymentStatus                  `json:"status"`
+		StatusCode        PaymentStatusCode              `json:"status_code"`
+		StatusDescription string                         `json:"status_description"`
+	}
 )
 
 // Get wallet info
@@ -606,6 +663,8 @@ type (
 	}
 
 	GetWalletInfoResponse struct {
+		RawFields `json:"-"`
+
 		Address    string        `json:"address"`
 		City       string        `json:"city"`
 		Country    string        `json:"country"`
@@ -629,6 +688,8 @@ type (
 	}
 
 	DeleteWalletCustomerResponse struct {
+		RawFields `json:"-"`
+
 		Delete   bool              `json:"delete"`
 		OptionID string            `json:"option_id"`
 		Type     PaymentMethodType `json:"type"`
@@ -0,0 +1,84 @@
+package rozetkapay_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+// Creates a payment against a gateway that records the request body and returns it decoded.
+func createPaymentBody(t *testing.T, schema *rozetkapay.CreatePaymentSchema) map[string]interface{} {
+	t.Helper()
+	var body []byte
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"id":"p1"}`))
+	}))
+	defer gateway.Close()
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	if _, err := rozetkapay.NewClient(cfg).CreatePayment(schema); err != nil {
+		t.Fatal(err)
+	}
+	var req map[string]interface{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("request body %q: %v", body, err)
+	}
+	return req
+}
+
+func TestCreatePaymentOmitsUnsetCustomer(t *testing.T) {
+	req := createPaymentBody(t, &rozetkapay.CreatePaymentSchema{Amount: 10, Currency: "UAH", ExternalID: "order-1", Mode: rozetkapay.PaymentModeHosted})
+	if _, ok := req["customer"]; ok {
+		t.Fatalf("request has a customer: %v", req["customer"])
+	}
+}
+
+func TestCreatePaymentOmitsUnsetPaymentMethod(t *testing.T) {
+	req := createPaymentBody(t, &rozetkapay.CreatePaymentSchema{
+		Amount:     10,
+		Currency:   "UAH",
+		ExternalID: "order-1",
+		Mode:       rozetkapay.PaymentModeHosted,
+		Customer:   &rozetkapay.CustomerData{ExternalID: "customer-1"},
+	})
+	customer, _ := req["customer"].(map[string]interface{})
+	if customer["external_id"] != "customer-1" {
+		t.Fatalf("customer %v", customer)
+	}
+	if _, ok := customer["payment_method"]; ok {
+		t.Fatalf("customer has a payment method: %v", customer["payment_method"])
+	}
+}
+
+func TestCreatePaymentEncodesOnlySetPaymentMethod(t *testing.T) {
+	req := createPaymentBody(t, &rozetkapay.CreatePaymentSchema{
+		Amount:     10,
+		Currency:   "UAH",
+		ExternalID: "order-1",
+		Mode:       rozetkapay.PaymentModeDirect,
+		Customer: &rozetkapay.CustomerData{
+			PaymentMethod: rozetkapay.PaymentMethod{
+				Type:    rozetkapay.PaymentMethodTypeCCToken,
+				CCToken: rozetkapay.CCToken{Token: "tok_visa"},
+			},
+		},
+	})
+	method, _ := req["customer"].(map[string]interface{})["payment_method"].(map[string]interface{})
+	if method["type"] != "cc_token" {
+		t.Fatalf("payment method %v", method)
+	}
+	if token, _ := method["cc_token"].(map[string]interface{}); token["token"] != "tok_visa" {
+		t.Fatalf("cc_token %v", method["cc_token"])
+	}
+	for _, key := range []string{"apple_pay", "google_pay", "wallet"} {
+		if _, ok := method[key]; ok {
+			t.Errorf("payment method has %s", key)
+		}
+	}
+}
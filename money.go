@@ -0,0 +1,93 @@
+package rozetkapay
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor currency units (e.g. kopiykas) with its currency.
+// Arithmetic on Money values expects their currencies to match.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// Parses a decimal amount as returned by the gateway, e.g. "100.50".
+func ParseMoney(amount, currency string) (Money, error) {
+	s := strings.TrimSpace(amount)
+	if s == "" {
+		return Money{Currency: currency}, nil
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return Money{}, fmt.Errorf("amount %q has more than 2 decimal places", amount)
+		}
+		frac = frac[:2]
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	w, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	f, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	minor := w*100 + f
+	if neg {
+		minor = -minor
+	}
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// Converts an amount as used in the request schemas, rounding to minor units.
+func NewMoney(amount float64, currency string) Money {
+	return Money{Amount: int64(math.Round(amount * 100)), Currency: currency}
+}
+
+// Returns the amount as used in the request schemas.
+func (m Money) Float64() float64 {
+	return float64(m.Amount) / 100
+}
+
+// Returns the amount formatted as a decimal, e.g. "100.50".
+func (m Money) Decimal() string {
+	sign := ""
+	a := m.Amount
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, a/100, a%100)
+}
+
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
@@ -0,0 +1,49 @@
+package rozetkapay
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Operation identifies a gateway call performed by the client.
+// It is used as a label for metrics, tracing spans and per-operation policies.
+type Operation string
+
+const (
+	OperationCreatePayment       Operation = "create_payment"
+	OperationConfirmPayment      Operation = "confirm_payment"
+	OperationCancelPayment       Operation = "cancel_payment"
+	OperationRefundPayment       Operation = "refund_payment"
+	OperationGetPaymentInfo      Operation = "get_payment_info"
+	OperationResendCallback      Operation = "resend_callback"
+	OperationAddWalletPayment    Operation = "add_wallet_payment"
+	OperationGetWalletInfo       Operation = "get_wallet_info"
+	OperationDeleteWalletPayment Operation = "delete_wallet_payment"
+)
+
+var endpointOperations = map[string]Operation{
+	http.MethodPost + " payments/v1/new":             OperationCreatePayment,
+	http.MethodPost + " payments/v1/confirm":         OperationConfirmPayment,
+	http.MethodPost + " payments/v1/cancel":          OperationCancelPayment,
+	http.MethodPost + " payments/v1/refund":          OperationRefundPayment,
+	http.MethodGet + " payments/v1/info":             OperationGetPaymentInfo,
+	http.MethodPost + " payments/v1/callback/resend": OperationResendCallback,
+	http.MethodPost + " customers/v1/wallet":         OperationAddWalletPayment,
+	http.MethodGet + " customers/v1/wallet":          OperationGetWalletInfo,
+	http.MethodDelete + " customers/v1/wallet":       OperationDeleteWalletPayment,
+}
+
+// Resolves the operation of the request by its method and path relative to the API url.
+// Requests to unknown endpoints are named after the method and path.
+func requestOperation(api string, req *http.Request) Operation {
+	u := *req.URL
+	u.RawQuery = ""
+	path := strings.TrimPrefix(u.String(), api)
+	if path == u.String() {
+		path = strings.TrimPrefix(u.Path, "/")
+	}
+	if op, ok := endpointOperations[req.Method+" "+path]; ok {
+		return op
+	}
+	return Operation(strings.ToLower(req.Method) + " " + path)
+}
@@ -0,0 +1,412 @@
+package rozetkapay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+type OutboxCommandKind string
+
+const (
+	OutboxCommandCreate  OutboxCommandKind = "create"
+	OutboxCommandConfirm OutboxCommandKind = "confirm"
+	OutboxCommandCancel  OutboxCommandKind = "cancel"
+	OutboxCommandRefund  OutboxCommandKind = "refund"
+)
+
+type OutboxCommandStatus string
+
+const (
+	OutboxCommandPending   OutboxCommandStatus = "pending"
+	OutboxCommandCompleted OutboxCommandStatus = "completed"
+	OutboxCommandFailed    OutboxCommandStatus = "failed"
+)
+
+// OutboxCommand is a payment command persisted before it is sent to the gateway.
+type OutboxCommand struct {
+	ID         string            `json:"id"`
+	Kind       OutboxCommandKind `json:"kind"`
+	ExternalID string            `json:"external_id"`
+
+	// The request schema of the command encoded as JSON.
+	Schema json.RawMessage `json:"schema"`
+
+	Status OutboxCommandStatus `json:"status"`
+
+	// Number of attempts started, counted when the command is claimed and before it is sent.
+	Attempts int `json:"attempts"`
+
+	// When the last attempt was started.
+	StartedAt time.Time `json:"started_at,omitempty"`
+
+	// The command is not claimed before this time. While an attempt is in flight
+	// it holds the end of the lease of the worker that claimed the command.
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Builds a pending command from one of CreatePaymentSchema, ConfirmPaymentSchema,
+// CancelPaymentSchema or RefundPaymentSchema.
+// Confirm, cancel and refund commands without a payload get the command id as payload,
+// it is used to find out whether the gateway already performed the command.
+func NewOutboxCommand(schema interface{}) (OutboxCommand, error) {
+	cmd := OutboxCommand{
+		ID:     randomHex(16),
+		Status: OutboxCommandPending,
+	}
+	switch s := schema.(type) {
+	case *CreatePaymentSchema:
+		cmd.Kind, cmd.ExternalID = OutboxCommandCreate, s.ExternalID
+	case *ConfirmPaymentSchema:
+		cmd.Kind, cmd.ExternalID = OutboxCommandConfirm, s.ExternalID
+		s.Payload = firstNonEmpty(s.Payload, cmd.ID)
+	case *CancelPaymentSchema:
+		cmd.Kind, cmd.ExternalID = OutboxCommandCancel, s.ExternalID
+		s.Payload = firstNonEmpty(s.Payload, cmd.ID)
+	case *RefundPaymentSchema:
+		cmd.Kind, cmd.ExternalID = OutboxCommandRefund, s.ExternalID
+		s.Payload = firstNonEmpty(s.Payload, cmd.ID)
+	default:
+		return OutboxCommand{}, fmt.Errorf("unsupported outbox schema %T", schema)
+	}
+	if cmd.ExternalID == "" {
+		return OutboxCommand{}, errors.New("outbox command external_id is empty")
+	}
+
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return OutboxCommand{}, err
+	}
+	now := time.Now()
+	cmd.Schema = b
+	cmd.CreatedAt = now
+	cmd.UpdatedAt = now
+	cmd.NextAttemptAt = now
+	return cmd, nil
+}
+
+// OutboxStore persists outbox commands. Enqueue is meant to run in the same
+// database transaction that stores the order.
+type OutboxStore interface {
+	Enqueue(cmd OutboxCommand) error
+
+	// Atomically takes up to limit pending commands due at the given time, oldest first.
+	// Every claimed command is stored with Attempts incremented, StartedAt set to now
+	// and NextAttemptAt set to now+lease, so no other worker claims it until the lease ends.
+	Claim(now time.Time, limit int, lease time.Duration) ([]OutboxCommand, error)
+
+	Update(cmd OutboxCommand) error
+}
+
+// MemoryOutboxStore keeps commands in memory.
+type MemoryOutboxStore struct {
+	mu       sync.Mutex
+	commands map[string]OutboxCommand
+}
+
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{commands: map[string]OutboxCommand{}}
+}
+
+func (s *MemoryOutboxStore) Enqueue(cmd OutboxCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.commands[cmd.ID]; ok {
+		return fmt.Errorf("outbox command %s already exists", cmd.ID)
+	}
+	s.commands[cmd.ID] = cmd
+	return nil
+}
+
+func (s *MemoryOutboxStore) Claim(now time.Time, limit int, lease time.Duration) ([]OutboxCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []OutboxCommand
+	for _, cmd := range s.commands {
+		if cmd.Status == OutboxCommandPending && !cmd.NextAttemptAt.After(now) {
+			due = append(due, cmd)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].Attempts++
+		due[i].StartedAt = now
+		due[i].NextAttemptAt = now.Add(lease)
+		due[i].UpdatedAt = now
+		s.commands[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (s *MemoryOutboxStore) Update(cmd OutboxCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.commands[cmd.ID]; !ok {
+		return fmt.Errorf("outbox command %s not found", cmd.ID)
+	}
+	s.commands[cmd.ID] = cmd
+	return nil
+}
+
+// Returns the command by id.
+func (s *MemoryOutboxStore) Get(id string) (OutboxCommand, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd, ok := s.commands[id]
+	return cmd, ok
+}
+
+// OutboxResult is what the gateway reported for a completed command.
+// Response is set when the command was sent in this attempt, Info when it was found
+// to be already performed by an earlier attempt.
+type OutboxResult struct {
+	Response *PaymentResponse
+	Info     *PaymentInfoResponse
+}
+
+type OutboxOptions struct {
+	// Number of attempts before the command is marked failed, 10 if not set.
+	MaxAttempts int
+
+	// Delay before the given attempt, exponential from one second up to ten minutes if not set.
+	Backoff func(attempt int) time.Duration
+
+	// Number of commands taken per drain, 100 if not set.
+	BatchSize int
+
+	// How long a claimed command is held by the worker. A command whose worker stopped
+	// before recording the outcome is claimed again after the lease and checked against
+	// the gateway before it is resent. Five minutes if not set, it should be well above
+	// the time a call to the gateway may take.
+	Lease time.Duration
+
+	// Interval Run polls the store at, one second if not set.
+	PollInterval time.Duration
+
+	// Called after the command is completed, to update the order state.
+	OnCompleted func(cmd OutboxCommand, result OutboxResult)
+
+	// Called after the command is rejected by the gateway or runs out of attempts.
+	OnFailed func(cmd OutboxCommand, err error)
+}
+
+// OutboxWorker sends pending outbox commands to the gateway.
+type OutboxWorker struct {
+	client *Client
+	store  OutboxStore
+	opts   OutboxOptions
+}
+
+func NewOutboxWorker(client *Client, store OutboxStore, opts OutboxOptions) *OutboxWorker {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = func(attempt int) time.Duration {
+			d := time.Second << uint(attempt-1)
+			if d <= 0 || d > 10*time.Minute {
+				d = 10 * time.Minute
+			}
+			return d
+		}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	return &OutboxWorker{client: client, store: store, opts: opts}
+}
+
+// Drains the outbox until the context is done.
+func (w *OutboxWorker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.DrainOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[RozetkaPay] Error --- type: %s, message: %s\n", "outbox", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Processes up to BatchSize commands due now and returns how many were processed.
+// Commands are claimed one at a time, so none is left claimed when the context is done.
+func (w *OutboxWorker) DrainOnce(ctx context.Context) (int, error) {
+	for i := 0; i < w.opts.BatchSize; i++ {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		claimed, err := w.store.Claim(time.Now(), 1, w.opts.Lease)
+		if err != nil {
+			return i, err
+		}
+		if len(claimed) == 0 {
+			return i, nil
+		}
+		if err := w.process(ctx, claimed[0]); err != nil {
+			return i, err
+		}
+	}
+	return w.opts.BatchSize, nil
+}
+
+func (w *OutboxWorker) process(ctx context.Context, cmd OutboxCommand) error {
+	// An earlier attempt may have reached the gateway even though it failed on our side
+	// or the worker stopped before recording its outcome.
+	if cmd.Attempts > 1 {
+		info, performed, err := w.performed(ctx, cmd)
+		if err != nil {
+			return w.retry(ctx, cmd, err)
+		}
+		if performed {
+			return w.complete(cmd, OutboxResult{Info: info})
+		}
+	}
+
+	resp, err := w.send(ctx, cmd)
+	if err == nil {
+		return w.complete(cmd, OutboxResult{Response: resp})
+	}
+	// The payment of a create may exist from an attempt whose outcome was lost.
+	if code, ok := ErrorStatusCode(err); ok && cmd.Kind == OutboxCommandCreate && code == StatusCodeTransactionAlreadyPaid {
+		if info, performed, perr := w.performed(ctx, cmd); perr == nil && performed {
+			return w.complete(cmd, OutboxResult{Info: info})
+		}
+	}
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) && !isGatewayFailure(errResp.HTTPStatus, err) || errors.Is(err, ErrEnvironmentMismatch) {
+		return w.fail(cmd, err)
+	}
+	return w.retry(ctx, cmd, err)
+}
+
+func (w *OutboxWorker) send(ctx context.Context, cmd OutboxCommand) (*PaymentResponse, error) {
+	switch cmd.Kind {
+	case OutboxCommandCreate:
+		var s CreatePaymentSchema
+		if err := json.Unmarshal(cmd.Schema, &s); err != nil {
+			return nil, err
+		}
+		return Do(ctx, w.client, CreatePaymentEndpoint, &s)
+	case OutboxCommandConfirm:
+		var s ConfirmPaymentSchema
+		if err := json.Unmarshal(cmd.Schema, &s); err != nil {
+			return nil, err
+		}
+		return Do(ctx, w.client, ConfirmPaymentEndpoint, &s)
+	case OutboxCommandCancel:
+		var s CancelPaymentSchema
+		if err := json.Unmarshal(cmd.Schema, &s); err != nil {
+			return nil, err
+		}
+		return Do(ctx, w.client, CancelPaymentEndpoint, &s)
+	case OutboxCommandRefund:
+		var s RefundPaymentSchema
+		if err := json.Unmarshal(cmd.Schema, &s); err != nil {
+			return nil, err
+		}
+		return Do(ctx, w.client, RefundPaymentEndpoint, &s)
+	}
+	return nil, fmt.Errorf("unknown outbox command kind %q", cmd.Kind)
+}
+
+// Checks through the payment info whether the gateway already performed the command.
+// A created payment is found by its external id, other commands by their payload.
+func (w *OutboxWorker) performed(ctx context.Context, cmd OutboxCommand) (*PaymentInfoResponse, bool, error) {
+	info, err := Do(ctx, w.client, PaymentInfoEndpoint, cmd.ExternalID)
+	if code, ok := ErrorStatusCode(err); ok && code == StatusCodeTransactionNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if cmd.Kind == OutboxCommandCreate {
+		return info, true, nil
+	}
+
+	var schema struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(cmd.Schema, &schema); err != nil {
+		return nil, false, err
+	}
+	var payloads []string
+	switch cmd.Kind {
+	case OutboxCommandConfirm:
+		for _, d := range info.ConfirmationDetails {
+			payloads = append(payloads, d.Payload)
+		}
+	case OutboxCommandCancel:
+		for _, d := range info.CancellationDetails {
+			payloads = append(payloads, d.Payload)
+		}
+	case OutboxCommandRefund:
+		for _, d := range info.RefundDetails {
+			payloads = append(payloads, d.Payload)
+		}
+	}
+	for _, p := range payloads {
+		if p == schema.Payload {
+			return info, true, nil
+		}
+	}
+	return info, false, nil
+}
+
+func (w *OutboxWorker) complete(cmd OutboxCommand, result OutboxResult) error {
+	cmd.Status = OutboxCommandCompleted
+	cmd.LastError = ""
+	cmd.UpdatedAt = time.Now()
+	if err := w.store.Update(cmd); err != nil {
+		return err
+	}
+	if w.opts.OnCompleted != nil {
+		w.opts.OnCompleted(cmd, result)
+	}
+	return nil
+}
+
+func (w *OutboxWorker) fail(cmd OutboxCommand, cause error) error {
+	cmd.Status = OutboxCommandFailed
+	cmd.LastError = cause.Error()
+	cmd.UpdatedAt = time.Now()
+	if err := w.store.Update(cmd); err != nil {
+		return err
+	}
+	if w.opts.OnFailed != nil {
+		w.opts.OnFailed(cmd, cause)
+	}
+	return nil
+}
+
+// Schedules the next attempt. A command interrupted by the context is never failed,
+// its outcome is unknown and the next attempt checks whether it was performed.
+func (w *OutboxWorker) retry(ctx context.Context, cmd OutboxCommand, cause error) error {
+	if cmd.Attempts >= w.opts.MaxAttempts && ctx.Err() == nil {
+		return w.fail(cmd, cause)
+	}
+	cmd.LastError = cause.Error()
+	cmd.UpdatedAt = time.Now()
+	cmd.NextAttemptAt = cmd.UpdatedAt.Add(w.opts.Backoff(cmd.Attempts))
+	return w.store.Update(cmd)
+}
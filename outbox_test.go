@@ -0,0 +1,237 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func enqueue(t *testing.T, store rozetkapay.OutboxStore, schema interface{}) rozetkapay.OutboxCommand {
+	t.Helper()
+	cmd, err := rozetkapay.NewOutboxCommand(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Enqueue(cmd); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+// Claims the command and sends it like a worker that stops before recording the outcome.
+func sendAndCrash(t *testing.T, c *rozetkapay.Client, store *rozetkapay.MemoryOutboxStore) {
+	t.Helper()
+	claimed, err := store.Claim(time.Now(), 1, 0)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("claim: %v, %d commands", err, len(claimed))
+	}
+	cmd := claimed[0]
+	switch cmd.Kind {
+	case rozetkapay.OutboxCommandCreate:
+		var s rozetkapay.CreatePaymentSchema
+		if err := json.Unmarshal(cmd.Schema, &s); err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.CreatePayment(&s)
+	case rozetkapay.OutboxCommandRefund:
+		var s rozetkapay.RefundPaymentSchema
+		if err := json.Unmarshal(cmd.Schema, &s); err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.RefundPayment(&s)
+	default:
+		t.Fatalf("unexpected command kind %s", cmd.Kind)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboxRefundNotResentAfterCrash(t *testing.T) {
+	srv, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+
+	store := rozetkapay.NewMemoryOutboxStore()
+	cmd := enqueue(t, store, &rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 40, Currency: "UAH"})
+	sendAndCrash(t, c, store)
+
+	var result rozetkapay.OutboxResult
+	w := rozetkapay.NewOutboxWorker(c, store, rozetkapay.OutboxOptions{
+		OnCompleted: func(_ rozetkapay.OutboxCommand, r rozetkapay.OutboxResult) { result = r },
+	})
+	if n, err := w.DrainOnce(context.Background()); err != nil || n != 1 {
+		t.Fatalf("DrainOnce = %d, %v", n, err)
+	}
+
+	got, _ := store.Get(cmd.ID)
+	if got.Status != rozetkapay.OutboxCommandCompleted || got.Attempts != 2 {
+		t.Fatalf("command status %s after %d attempts", got.Status, got.Attempts)
+	}
+	if result.Info == nil || result.Response != nil {
+		t.Fatal("command was sent again instead of being found performed")
+	}
+	info, _ := srv.Payment("order-1")
+	if info.AmountRefunded != "40.00" || len(info.RefundDetails) != 1 {
+		t.Fatalf("refunded %s in %d refunds", info.AmountRefunded, len(info.RefundDetails))
+	}
+}
+
+func TestOutboxCreateCompletedAfterCrash(t *testing.T) {
+	srv, c := newFakeClient(t)
+	store := rozetkapay.NewMemoryOutboxStore()
+	cmd := enqueue(t, store, &rozetkapay.CreatePaymentSchema{
+		ExternalID: "order-1",
+		Amount:     100,
+		Currency:   "UAH",
+		Mode:       rozetkapay.PaymentModeHosted,
+	})
+	sendAndCrash(t, c, store)
+
+	w := rozetkapay.NewOutboxWorker(c, store, rozetkapay.OutboxOptions{})
+	if _, err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.Get(cmd.ID)
+	if got.Status != rozetkapay.OutboxCommandCompleted {
+		t.Fatalf("command status %s: %s", got.Status, got.LastError)
+	}
+	if _, ok := srv.Payment("order-1"); !ok {
+		t.Fatal("payment not created")
+	}
+}
+
+func TestOutboxClaimHidesCommandFromOtherWorkers(t *testing.T) {
+	store := rozetkapay.NewMemoryOutboxStore()
+	enqueue(t, store, &rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 1, Currency: "UAH"})
+
+	now := time.Now()
+	first, err := store.Claim(now, 10, time.Minute)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("first claim: %v, %d commands", err, len(first))
+	}
+	if first[0].Attempts != 1 || !first[0].StartedAt.Equal(now) {
+		t.Fatalf("claimed command not marked as started: %+v", first[0])
+	}
+	if second, _ := store.Claim(now, 10, time.Minute); len(second) != 0 {
+		t.Fatal("command claimed twice within the lease")
+	}
+	if again, _ := store.Claim(now.Add(2*time.Minute), 10, time.Minute); len(again) != 1 || again[0].Attempts != 2 {
+		t.Fatal("command not claimed again after the lease")
+	}
+}
+
+func TestOutboxConcurrentWorkers(t *testing.T) {
+	srv, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+
+	store := rozetkapay.NewMemoryOutboxStore()
+	for i := 0; i < 10; i++ {
+		enqueue(t, store, &rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 5, Currency: "UAH"})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := rozetkapay.NewOutboxWorker(c, store, rozetkapay.OutboxOptions{})
+			if _, err := w.DrainOnce(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	info, _ := srv.Payment("order-1")
+	if info.AmountRefunded != "50.00" || len(info.RefundDetails) != 10 {
+		t.Fatalf("refunded %s in %d refunds, want 50.00 in 10", info.AmountRefunded, len(info.RefundDetails))
+	}
+}
+
+func TestOutboxRejectedCommandFails(t *testing.T) {
+	_, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 100, "tok_visa")
+
+	store := rozetkapay.NewMemoryOutboxStore()
+	cmd := enqueue(t, store, &rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 500, Currency: "UAH"})
+
+	var failed error
+	w := rozetkapay.NewOutboxWorker(c, store, rozetkapay.OutboxOptions{
+		OnFailed: func(_ rozetkapay.OutboxCommand, err error) { failed = err },
+	})
+	if _, err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.Get(cmd.ID)
+	if got.Status != rozetkapay.OutboxCommandFailed || got.Attempts != 1 {
+		t.Fatalf("command status %s after %d attempts", got.Status, got.Attempts)
+	}
+	var errResp *rozetkapay.ErrorResponse
+	if !errors.As(failed, &errResp) {
+		t.Fatalf("OnFailed error = %v", failed)
+	}
+}
+
+func TestOutboxRetriesUntilMaxAttempts(t *testing.T) {
+	srv, c := newFakeClient(t)
+	srv.Server.Close()
+
+	store := rozetkapay.NewMemoryOutboxStore()
+	cmd := enqueue(t, store, &rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 1, Currency: "UAH"})
+
+	w := rozetkapay.NewOutboxWorker(c, store, rozetkapay.OutboxOptions{
+		MaxAttempts: 3,
+		Backoff:     func(int) time.Duration { return 0 },
+	})
+	// Without backoff the command is due again at once and retried within the same drain.
+	if _, err := w.DrainOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.Get(cmd.ID)
+	if got.Status != rozetkapay.OutboxCommandFailed || got.Attempts != 3 || got.LastError == "" {
+		t.Fatalf("command status %s after %d attempts, error %q", got.Status, got.Attempts, got.LastError)
+	}
+}
+
+func TestOutboxRunCancelsInFlightCall(t *testing.T) {
+	block := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-block:
+		}
+	}))
+	defer gateway.Close()
+	defer close(block)
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	c := rozetkapay.NewClient(cfg)
+
+	store := rozetkapay.NewMemoryOutboxStore()
+	cmd := enqueue(t, store, &rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 1, Currency: "UAH"})
+	w := rozetkapay.NewOutboxWorker(c, store, rozetkapay.OutboxOptions{MaxAttempts: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := w.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Run returned after %s", elapsed)
+	}
+
+	// The outcome of the interrupted attempt is unknown, the command stays pending.
+	got, _ := store.Get(cmd.ID)
+	if got.Status != rozetkapay.OutboxCommandPending || got.Attempts != 1 || got.LastError == "" {
+		t.Fatalf("command status %s after %d attempts, error %q", got.Status, got.Attempts, got.LastError)
+	}
+}
@@ -0,0 +1,162 @@
+package rozetkapay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownStore error = errors.New("unknown store")
+)
+
+// Query parameter naming the store in callback urls built by StoreCallbackURL.
+const StoreQueryParam = "store"
+
+// Handles a decoded callback of the store.
+type CallbackHandler func(storeID string, event CallbackEvent) error
+
+type poolStore struct {
+	config  *Config
+	opts    []ClientOpts
+	client  *Client
+	handler CallbackHandler
+}
+
+// ClientPool keeps a client per store, each with its own credentials.
+// Clients are built on first use.
+type ClientPool struct {
+	// Returns the store a callback request is for, the StoreQueryParam query parameter if not set.
+	StoreFromRequest func(r *http.Request) string
+
+	opts   []ClientOpts
+	mu     sync.Mutex
+	stores map[string]*poolStore
+}
+
+// Creates a pool whose clients are all built with the given options.
+func NewClientPool(opts ...ClientOpts) *ClientPool {
+	return &ClientPool{opts: opts, stores: map[string]*poolStore{}}
+}
+
+// Adds or replaces the store. Options are applied after the options of the pool.
+func (p *ClientPool) Register(storeID string, config *Config, opts ...ClientOpts) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &poolStore{config: config, opts: opts}
+	if old, ok := p.stores[storeID]; ok {
+		s.handler = old.handler
+	}
+	p.stores[storeID] = s
+}
+
+func (p *ClientPool) Remove(storeID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.stores, storeID)
+}
+
+// Returns the registered store ids, sorted.
+func (p *ClientPool) Stores() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]string, 0, len(p.stores))
+	for id := range p.stores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Returns the client of the store, building it on first use.
+func (p *ClientPool) Client(storeID string) (*Client, error) {
+	client, _, err := p.store(storeID)
+	return client, err
+}
+
+// Returns the client and the callback handler of the store.
+func (p *ClientPool) store(storeID string) (*Client, CallbackHandler, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.stores[storeID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownStore, storeID)
+	}
+	if s.client == nil {
+		s.client = NewClient(s.config, append(append([]ClientOpts{}, p.opts...), s.opts...)...)
+	}
+	return s.client, s.handler, nil
+}
+
+// Replaces the credentials of the store. Calls already in flight finish with the old credentials.
+func (p *ClientPool) RotateCredentials(storeID, login, password string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.stores[storeID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownStore, storeID)
+	}
+	creds := Credentials{Login: login, Password: password}
+	config := *s.config
+	config.BasicAuth = creds.basicAuth()
+	s.config = &config
+	if s.client != nil {
+		s.client.SetCredentials(creds)
+	}
+	return nil
+}
+
+// Sets the handler of the store's callbacks received by ServeHTTP.
+func (p *ClientPool) HandleCallbacks(storeID string, h CallbackHandler) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.stores[storeID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownStore, storeID)
+	}
+	s.handler = h
+	return nil
+}
+
+// Decodes the callback with the client of the store it is for and passes it to the store's handler.
+func (p *ClientPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	storeID := r.URL.Query().Get(StoreQueryParam)
+	if p.StoreFromRequest != nil {
+		storeID = p.StoreFromRequest(r)
+	}
+	client, handler, err := p.store(storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if handler == nil {
+		http.Error(w, "no callback handler for store "+storeID, http.StatusNotFound)
+		return
+	}
+
+	event, err := client.DecodeCallbackRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := handler(storeID, event); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Returns the callback url with the store added as the StoreQueryParam query parameter.
+func StoreCallbackURL(callbackURL, storeID string) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(StoreQueryParam, storeID)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,168 @@
+package rozetkapay_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func TestClientPoolBuildsClientsOnFirstUse(t *testing.T) {
+	var built []string
+	option := func(name string) rozetkapay.ClientOpts {
+		return func(*rozetkapay.Client) { built = append(built, name) }
+	}
+	pool := rozetkapay.NewClientPool(option("pool"))
+	pool.Register("store-1", rozetkapay.NewConfig("merchant", "secret"), option("store"))
+	if len(built) != 0 {
+		t.Fatalf("client built on Register: %v", built)
+	}
+
+	c, err := pool.Client("store-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(built, ",") != "pool,store" {
+		t.Fatalf("options applied %v, want pool then store", built)
+	}
+	again, err := pool.Client("store-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != c || len(built) != 2 {
+		t.Fatalf("client rebuilt, options applied %v", built)
+	}
+
+	// Registering again replaces the store and its client.
+	pool.Register("store-1", rozetkapay.NewConfig("merchant", "secret"))
+	if replaced, _ := pool.Client("store-1"); replaced == c {
+		t.Fatal("client kept after the store was registered again")
+	}
+
+	if _, err := pool.Client("store-2"); !errors.Is(err, rozetkapay.ErrUnknownStore) {
+		t.Fatalf("unknown store error = %v", err)
+	}
+	pool.Remove("store-1")
+	if stores := pool.Stores(); len(stores) != 0 {
+		t.Fatalf("stores after Remove: %v", stores)
+	}
+}
+
+func TestClientPoolRotateCredentials(t *testing.T) {
+	var logins []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		login, _, _ := r.BasicAuth()
+		logins = append(logins, login)
+		w.Write([]byte(`{"id":"p1"}`))
+	}))
+	defer gateway.Close()
+
+	pool := rozetkapay.NewClientPool()
+	for _, id := range []string{"built", "lazy"} {
+		cfg := rozetkapay.NewConfig("old-"+id, "secret")
+		cfg.API = gateway.URL + "/"
+		pool.Register(id, cfg)
+	}
+	built, err := pool.Client("built")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := built.GetPaymentInfo("order-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"built", "lazy"} {
+		if err := pool.RotateCredentials(id, "new-"+id, "secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := built.GetPaymentInfo("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := pool.Client("lazy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lazy.GetPaymentInfo("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(logins, ","); got != "old-built,new-built,new-lazy" {
+		t.Fatalf("logins %s", got)
+	}
+
+	if err := pool.RotateCredentials("unknown", "login", "secret"); !errors.Is(err, rozetkapay.ErrUnknownStore) {
+		t.Fatalf("unknown store error = %v", err)
+	}
+}
+
+func TestClientPoolServeHTTP(t *testing.T) {
+	pool := rozetkapay.NewClientPool()
+	pool.Register("store-1", rozetkapay.NewConfig("merchant", "secret"))
+	pool.Register("store-2", rozetkapay.NewConfig("merchant", "secret"))
+
+	var (
+		gotStore string
+		gotEvent rozetkapay.CallbackEvent
+	)
+	if err := pool.HandleCallbacks("store-1", func(storeID string, event rozetkapay.CallbackEvent) error {
+		gotStore, gotEvent = storeID, event
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.HandleCallbacks("unknown", nil); !errors.Is(err, rozetkapay.ErrUnknownStore) {
+		t.Fatalf("unknown store error = %v", err)
+	}
+
+	body := withOperation(t, samplePaymentCallback, "payment")
+	serve := func(target string) int {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return w.Code
+	}
+
+	callbackURL, err := rozetkapay.StoreCallbackURL("https://shop.example/callback?source=rozetkapay", "store-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(callbackURL); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	event, ok := gotEvent.(rozetkapay.PaymentCallbackEvent)
+	if gotStore != "store-1" || !ok || event.ExternalID != "order-1" {
+		t.Fatalf("store %q, event %#v", gotStore, gotEvent)
+	}
+
+	if code := serve("/callback?store=unknown"); code != http.StatusNotFound {
+		t.Fatalf("unknown store status %d", code)
+	}
+	if code := serve("/callback"); code != http.StatusNotFound {
+		t.Fatalf("missing store status %d", code)
+	}
+	gotStore = ""
+	if code := serve("/callback?store=store-2"); code != http.StatusNotFound || gotStore != "" {
+		t.Fatalf("store without a handler: status %d, handled by %q", code, gotStore)
+	}
+}
+
+func TestClientPoolStoreFromRequest(t *testing.T) {
+	pool := rozetkapay.NewClientPool()
+	pool.Register("store-1", rozetkapay.NewConfig("merchant", "secret"))
+	pool.StoreFromRequest = func(r *http.Request) string { return r.Header.Get("X-Store") }
+
+	var gotStore string
+	pool.HandleCallbacks("store-1", func(storeID string, event rozetkapay.CallbackEvent) error {
+		gotStore = storeID
+		return errors.New("handler failed")
+	})
+	r := httptest.NewRequest(http.MethodPost, "/callback?store=other", strings.NewReader(samplePaymentCallback))
+	r.Header.Set("X-Store", "store-1")
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, r)
+	if gotStore != "store-1" || w.Code != http.StatusInternalServerError {
+		t.Fatalf("handled by %q, status %d", gotStore, w.Code)
+	}
+}
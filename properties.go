@@ -0,0 +1,144 @@
+package rozetkapay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrPropertyNotSet error = errors.New("property is not set")
+)
+
+// Properties are the additional key:value parameters of a payment,
+// sent with the payment request and returned with every operation of it.
+// Values are kept as strings, see UnmarshalJSON.
+type Properties map[string]string
+
+// Deprecated: the properties of a payment are arbitrary, use Properties.
+// Property1 and Property2 are now read with Get("property1") and Get("property2").
+type PaymentResponseDetailsProperties = Properties
+
+// Decodes properties leniently: string values are taken as is, other values
+// as their JSON text, so properties the gateway returns as numbers or booleans are not lost.
+// The values are coerced to strings and encoded back as such: {"n":1} becomes {"n":"1"}.
+// Use Int, Float and Bool to read them as their type.
+func (p *Properties) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if fields == nil {
+		*p = nil
+		return nil
+	}
+	props := make(Properties, len(fields))
+	for key, raw := range fields {
+		if bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		props[key] = s
+	}
+	*p = props
+	return nil
+}
+
+// Returns the value of the property, empty if not set.
+func (p Properties) Get(key string) string {
+	return p[key]
+}
+
+// Returns the value of the property and whether it is set.
+func (p Properties) Lookup(key string) (string, bool) {
+	v, ok := p[key]
+	return v, ok
+}
+
+func (p Properties) Int(key string) (int64, error) {
+	v, err := p.value(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("property %s: invalid integer %q", key, v)
+	}
+	return i, nil
+}
+
+func (p Properties) Float(key string) (float64, error) {
+	v, err := p.value(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("property %s: invalid number %q", key, v)
+	}
+	return f, nil
+}
+
+func (p Properties) Bool(key string) (bool, error) {
+	v, err := p.value(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("property %s: invalid boolean %q", key, v)
+	}
+	return b, nil
+}
+
+// Parses an RFC 3339 time, as written by SetTime.
+func (p Properties) Time(key string) (time.Time, error) {
+	v, err := p.value(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("property %s: invalid time %q", key, v)
+	}
+	return t, nil
+}
+
+func (p Properties) value(key string) (string, error) {
+	v, ok := p[key]
+	if !ok {
+		return "", fmt.Errorf("property %s: %w", key, ErrPropertyNotSet)
+	}
+	return v, nil
+}
+
+// Sets the property, creating the map if nil.
+func (p *Properties) Set(key, value string) *Properties {
+	if *p == nil {
+		*p = Properties{}
+	}
+	(*p)[key] = value
+	return p
+}
+
+func (p *Properties) SetInt(key string, value int64) *Properties {
+	return p.Set(key, strconv.FormatInt(value, 10))
+}
+
+func (p *Properties) SetFloat(key string, value float64) *Properties {
+	return p.Set(key, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func (p *Properties) SetBool(key string, value bool) *Properties {
+	return p.Set(key, strconv.FormatBool(value))
+}
+
+func (p *Properties) SetTime(key string, value time.Time) *Properties {
+	return p.Set(key, value.Format(time.RFC3339Nano))
+}
@@ -0,0 +1,92 @@
+package rozetkapay_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	var p rozetkapay.Properties
+	at := time.Date(2024, 3, 1, 10, 0, 0, 500, time.UTC)
+	p.Set("plan", "basic").SetInt("seats", 3).SetFloat("ratio", 0.25).SetBool("trial", true).SetTime("at", at)
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got rozetkapay.Properties
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("plan") != "basic" {
+		t.Fatalf("plan = %q", got.Get("plan"))
+	}
+	if n, err := got.Int("seats"); err != nil || n != 3 {
+		t.Fatalf("seats = %d, %v", n, err)
+	}
+	if f, err := got.Float("ratio"); err != nil || f != 0.25 {
+		t.Fatalf("ratio = %v, %v", f, err)
+	}
+	if v, err := got.Bool("trial"); err != nil || !v {
+		t.Fatalf("trial = %v, %v", v, err)
+	}
+	if v, err := got.Time("at"); err != nil || !v.Equal(at) {
+		t.Fatalf("at = %v, %v", v, err)
+	}
+}
+
+func TestPropertiesCoerceValuesToStrings(t *testing.T) {
+	var p rozetkapay.Properties
+	if err := json.Unmarshal([]byte(`{"n":1,"f":1.5,"b":true,"s":"x","o":{"k":1},"z":null}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"n": "1", "f": "1.5", "b": "true", "s": "x", "o": `{"k":1}`}
+	for key, v := range want {
+		if p.Get(key) != v {
+			t.Errorf("%s = %q, want %q", key, p.Get(key), v)
+		}
+	}
+	if _, ok := p.Lookup("z"); ok {
+		t.Error("null property kept")
+	}
+	if n, err := p.Int("n"); err != nil || n != 1 {
+		t.Errorf("Int(n) = %d, %v", n, err)
+	}
+
+	b, err := json.Marshal(rozetkapay.Properties{"n": p.Get("n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"n":"1"}` {
+		t.Fatalf("encoded as %s", b)
+	}
+}
+
+func TestPropertiesErrors(t *testing.T) {
+	var p rozetkapay.Properties
+	if _, err := p.Int("missing"); !errors.Is(err, rozetkapay.ErrPropertyNotSet) {
+		t.Fatalf("Int on a missing property = %v", err)
+	}
+	p.Set("n", "one")
+	if _, err := p.Int("n"); err == nil || errors.Is(err, rozetkapay.ErrPropertyNotSet) {
+		t.Fatalf("Int on an invalid value = %v", err)
+	}
+	if err := json.Unmarshal([]byte(`null`), &p); err != nil || p != nil {
+		t.Fatalf("null decoded as %v, %v", p, err)
+	}
+}
+
+func TestPaymentDetailsProperties(t *testing.T) {
+	var resp rozetkapay.PaymentResponse
+	if err := json.Unmarshal([]byte(`{"details":{"properties":{"property1":"a","order":42}}}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var props rozetkapay.PaymentResponseDetailsProperties = resp.Details.Properties
+	if props.Get("property1") != "a" || props.Get("order") != "42" {
+		t.Fatalf("properties %v", props)
+	}
+}
@@ -0,0 +1,154 @@
+package rozetkapay
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OperationClass groups operations sharing a rate limit.
+type OperationClass string
+
+const (
+	OperationClassRead     OperationClass = "read"
+	OperationClassMutation OperationClass = "mutation"
+)
+
+func requestClass(req *http.Request) OperationClass {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return OperationClassRead
+	}
+	return OperationClassMutation
+}
+
+type RateLimit struct {
+	// Sustained number of requests per second, zero means no limit.
+	Rate float64
+
+	// Number of requests that may be sent at once after a quiet period.
+	Burst int
+}
+
+// RateLimiter is a token-bucket limiter with a separate bucket per operation class.
+type RateLimiter struct {
+	// How many times a request throttled by the gateway is repeated
+	// after waiting for the duration of its Retry-After header.
+	MaxRetries int
+
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets map[OperationClass]*tokenBucket
+}
+
+type tokenBucket struct {
+	limit       RateLimit
+	tokens      float64
+	updatedAt   time.Time
+	pausedUntil time.Time
+}
+
+func NewRateLimiter(reads, mutations RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		MaxRetries: 3,
+		now:        time.Now,
+		buckets:    map[OperationClass]*tokenBucket{},
+	}
+	now := l.now()
+	for class, limit := range map[OperationClass]RateLimit{
+		OperationClassRead:     reads,
+		OperationClassMutation: mutations,
+	} {
+		if limit.Burst <= 0 {
+			limit.Burst = 1
+		}
+		l.buckets[class] = &tokenBucket{limit: limit, tokens: float64(limit.Burst), updatedAt: now}
+	}
+	return l
+}
+
+// Blocks until a request of the class may be sent or the context is done.
+// Returns context.DeadlineExceeded right away if the context deadline comes before the slot.
+func (l *RateLimiter) Wait(ctx context.Context, class OperationClass) error {
+	l.mu.Lock()
+	b, ok := l.buckets[class]
+	if !ok {
+		l.mu.Unlock()
+		return nil
+	}
+	now := l.now()
+	ready := b.reserve(now)
+	if ready.IsZero() {
+		l.mu.Unlock()
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(ready) {
+		b.cancel()
+		l.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	l.mu.Unlock()
+
+	timer := time.NewTimer(ready.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		b.cancel()
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Stops sending requests of the class until the given time.
+func (l *RateLimiter) Pause(class OperationClass, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[class]; ok && until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// Takes a token and returns the time the request may be sent at, zero if right now.
+func (b *tokenBucket) reserve(now time.Time) time.Time {
+	if b.limit.Rate > 0 {
+		elapsed := now.Sub(b.updatedAt).Seconds()
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.updatedAt = now
+		b.tokens--
+	}
+
+	var ready time.Time
+	if b.limit.Rate > 0 && b.tokens < 0 {
+		ready = now.Add(time.Duration(-b.tokens / b.limit.Rate * float64(time.Second)))
+	}
+	if b.pausedUntil.After(now) && b.pausedUntil.After(ready) {
+		ready = b.pausedUntil
+	}
+	return ready
+}
+
+func (b *tokenBucket) cancel() {
+	if b.limit.Rate > 0 {
+		b.tokens++
+	}
+}
+
+// Parses the Retry-After header given either in seconds or as an HTTP date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,237 @@
+package rozetkapay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Rate limiter with a clock moved by the test. The clock starts at the
+// real time, so context deadlines can be compared with the slots it hands out.
+func (c *fakeClock) limiter(reads, mutations RateLimit) *RateLimiter {
+	l := NewRateLimiter(reads, mutations)
+	l.now = c.now
+	for _, b := range l.buckets {
+		b.updatedAt = c.t
+	}
+	return l
+}
+
+// Waits for a slot with a deadline too close to sleep for it.
+func waitNow(l *RateLimiter, class OperationClass) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	return l.Wait(ctx, class)
+}
+
+func TestRateLimiterRefillsTokens(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	l := clock.limiter(RateLimit{}, RateLimit{Rate: 1, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		if err := waitNow(l, OperationClassMutation); err != nil {
+			t.Fatalf("request %d within the burst: %v", i+1, err)
+		}
+	}
+	if err := waitNow(l, OperationClassMutation); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request over the burst = %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := waitNow(l, OperationClassRead); err != nil {
+			t.Fatalf("unlimited class waited: %v", err)
+		}
+	}
+
+	clock.add(time.Second)
+	if err := waitNow(l, OperationClassMutation); err != nil {
+		t.Fatalf("request after a refill: %v", err)
+	}
+	if err := waitNow(l, OperationClassMutation); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second request after one refilled token = %v", err)
+	}
+
+	// Tokens refill up to the burst only.
+	clock.add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := waitNow(l, OperationClassMutation); err != nil {
+			t.Fatalf("request %d after a quiet period: %v", i+1, err)
+		}
+	}
+	if err := waitNow(l, OperationClassMutation); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request over the burst after a quiet period = %v", err)
+	}
+}
+
+func TestRateLimiterDeadlineShortCircuits(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	l := clock.limiter(RateLimit{Rate: 0.01, Burst: 1}, RateLimit{})
+	if err := waitNow(l, OperationClassRead); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next slot is 100 seconds away, the call must not sleep until the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := l.Wait(ctx, OperationClassRead); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Wait returned after %s", elapsed)
+	}
+
+	// The rejected call gave its token back.
+	clock.add(100 * time.Second)
+	if err := waitNow(l, OperationClassRead); err != nil {
+		t.Fatalf("request after the refill: %v", err)
+	}
+}
+
+func TestRateLimiterRefundsTokenOnCancel(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	l := clock.limiter(RateLimit{}, RateLimit{Rate: 1, Burst: 1})
+	if err := waitNow(l, OperationClassMutation); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, OperationClassMutation); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait = %v", err)
+	}
+
+	// Without the refund the bucket would be a token short a second later.
+	clock.add(time.Second)
+	if err := waitNow(l, OperationClassMutation); err != nil {
+		t.Fatalf("request after the refill: %v", err)
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	l := clock.limiter(RateLimit{}, RateLimit{})
+
+	l.Pause(OperationClassMutation, clock.t.Add(5*time.Second))
+	l.Pause(OperationClassMutation, clock.t.Add(time.Second))
+	if err := waitNow(l, OperationClassMutation); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request while paused = %v", err)
+	}
+	if err := waitNow(l, OperationClassRead); err != nil {
+		t.Fatalf("other class paused: %v", err)
+	}
+
+	// An earlier pause does not shorten a later one.
+	clock.add(2 * time.Second)
+	if err := waitNow(l, OperationClassMutation); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request after the shorter pause = %v", err)
+	}
+	clock.add(3 * time.Second)
+	if err := waitNow(l, OperationClassMutation); err != nil {
+		t.Fatalf("request after the pause: %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{now.Add(-10 * time.Second).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(header, now); got != tt.want {
+			t.Errorf("Retry-After %q = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Gateway throttling the first requests, it records the bodies it receives.
+func throttlingGateway(t *testing.T, throttled int) (*httptest.Server, *[]string) {
+	var bodies []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= throttled {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code":"too_many_requests","message":"slow down"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"p1"}`))
+	}))
+	t.Cleanup(gateway.Close)
+	return gateway, &bodies
+}
+
+func throttledClient(gateway *httptest.Server, l *RateLimiter) *Client {
+	cfg := NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	var opts []ClientOpts
+	if l != nil {
+		opts = append(opts, WithRateLimiter(l))
+	}
+	return NewClient(cfg, opts...)
+}
+
+func TestSendRetriesThrottledRequests(t *testing.T) {
+	gateway, bodies := throttlingGateway(t, 2)
+	// The clock runs ahead of the pauses set from the Retry-After header, so the retries do not sleep.
+	clock := &fakeClock{t: time.Now().Add(time.Hour)}
+	l := clock.limiter(RateLimit{}, RateLimit{})
+
+	before := time.Now()
+	resp, err := throttledClient(gateway, l).CreatePayment(&CreatePaymentSchema{Amount: 10, Currency: "UAH", ExternalID: "order-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "p1" || len(*bodies) != 3 {
+		t.Fatalf("response %+v after %d requests", resp, len(*bodies))
+	}
+	for i, body := range *bodies {
+		if body != (*bodies)[0] || body == "" {
+			t.Fatalf("request %d body %q, first %q", i+1, body, (*bodies)[0])
+		}
+	}
+	if paused := l.buckets[OperationClassMutation].pausedUntil; paused.Before(before.Add(2 * time.Second)) {
+		t.Fatalf("paused until %s, Retry-After not honoured", paused)
+	}
+}
+
+func TestSendGivesUpAfterMaxRetries(t *testing.T) {
+	gateway, bodies := throttlingGateway(t, 10)
+	clock := &fakeClock{t: time.Now().Add(time.Hour)}
+	l := clock.limiter(RateLimit{}, RateLimit{})
+	l.MaxRetries = 1
+
+	if _, err := throttledClient(gateway, l).CreatePayment(&CreatePaymentSchema{Amount: 10, Currency: "UAH", ExternalID: "order-1"}); err == nil {
+		t.Fatal("throttled request succeeded")
+	}
+	if len(*bodies) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(*bodies))
+	}
+}
+
+func TestSendWithoutLimiterDoesNotRetry(t *testing.T) {
+	gateway, bodies := throttlingGateway(t, 1)
+	if _, err := throttledClient(gateway, nil).CreatePayment(&CreatePaymentSchema{Amount: 10, Currency: "UAH", ExternalID: "order-1"}); err == nil {
+		t.Fatal("throttled request succeeded")
+	}
+	if len(*bodies) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(*bodies))
+	}
+}
@@ -0,0 +1,298 @@
+package rozetkapay
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SettlementRow is a line of a settlement or transaction report.
+type SettlementRow struct {
+	Line           int
+	ExternalID     string
+	TransactionID  string
+	RRN            string
+	BillingOrderID string
+	Amount         Money
+	Fee            Money
+	Status         string
+
+	// Whether the report has the fee and currency columns. Fees and currencies
+	// of reports without them are not compared.
+	HasFee      bool
+	HasCurrency bool
+}
+
+// Report columns recognised by ReadSettlementReport, matched case-insensitively.
+var settlementColumns = map[string][]string{
+	"external_id":      {"external_id", "order_id"},
+	"transaction_id":   {"transaction_id"},
+	"rrn":              {"rrn"},
+	"billing_order_id": {"billing_order_id"},
+	"amount":           {"amount"},
+	"fee":              {"fee", "fee_amount", "commission"},
+	"currency":         {"currency"},
+	"status":           {"status"},
+}
+
+// Columns identifying the transaction of a report row, see Reconcile.
+var settlementIDColumns = []string{"transaction_id", "rrn", "billing_order_id", "external_id"}
+
+// Reads a settlement report CSV. The first line must be a header naming the columns,
+// unknown columns are ignored and at least one of the identifier columns, transaction_id,
+// rrn, billing_order_id or external_id, is required.
+func ReadSettlementReport(r io.Reader) ([]SettlementRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("settlement report header: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for column, aliases := range settlementColumns {
+			for _, alias := range aliases {
+				if name == alias {
+					index[column] = i
+				}
+			}
+		}
+	}
+	hasID := false
+	for _, column := range settlementIDColumns {
+		if _, ok := index[column]; ok {
+			hasID = true
+		}
+	}
+	if !hasID {
+		return nil, fmt.Errorf("settlement report has none of the identifier columns %v", settlementIDColumns)
+	}
+
+	_, hasFee := index["fee"]
+	_, hasCurrency := index["currency"]
+
+	var rows []SettlementRow
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(column string) string {
+			if i, ok := index[column]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		currency := strings.ToUpper(field("currency"))
+		amount, err := ParseMoney(field("amount"), currency)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		fee, err := ParseMoney(field("fee"), currency)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, SettlementRow{
+			Line:           line,
+			ExternalID:     field("external_id"),
+			TransactionID:  field("transaction_id"),
+			RRN:            field("rrn"),
+			BillingOrderID: field("billing_order_id"),
+			Amount:         amount,
+			Fee:            fee,
+			Status:         strings.ToLower(field("status")),
+			HasFee:         hasFee,
+			HasCurrency:    hasCurrency,
+		})
+	}
+}
+
+// ReconcileRecord is a transaction as recorded on our side.
+type ReconcileRecord struct {
+	ExternalID     string
+	TransactionID  string
+	RRN            string
+	BillingOrderID string
+	Amount         Money
+	Fee            Money
+	Status         PaymentStatus
+}
+
+// Builds a record from the details of a payment response or callback.
+func ReconcileRecordFromDetails(externalID string, d PaymentResponseDetails) (ReconcileRecord, error) {
+	amount, err := ParseMoney(d.Amount, d.Currency)
+	if err != nil {
+		return ReconcileRecord{}, err
+	}
+	fee, err := ParseMoney(d.Fee.Amount, firstNonEmpty(d.Fee.Currency, d.Currency))
+	if err != nil {
+		return ReconcileRecord{}, err
+	}
+	return ReconcileRecord{
+		ExternalID:     externalID,
+		TransactionID:  d.TransactionID,
+		RRN:            d.RRN,
+		BillingOrderID: d.BillingOrderID,
+		Amount:         amount,
+		Fee:            fee,
+		Status:         d.Status,
+	}, nil
+}
+
+type MismatchKind string
+
+const (
+	// Our record has no row in the report.
+	MismatchMissingInReport MismatchKind = "missing_in_report"
+
+	// The report row has no record on our side.
+	MismatchMissingInRecords MismatchKind = "missing_in_records"
+
+	MismatchAmountDiffers MismatchKind = "amount_differs"
+	MismatchFeeDiffers    MismatchKind = "fee_differs"
+	MismatchStatusDiffers MismatchKind = "status_differs"
+
+	// The report contains several rows for the same record.
+	MismatchDuplicate MismatchKind = "duplicate"
+)
+
+type Mismatch struct {
+	Kind   MismatchKind
+	Record *ReconcileRecord
+	Row    *SettlementRow
+
+	// Our value and the value of the report for the differing field.
+	Expected string
+	Actual   string
+}
+
+type ReconciliationReport struct {
+	// Number of report rows matched to a record without differences.
+	Matched    int
+	Mismatches []Mismatch
+}
+
+// Matches report rows to records by the first identifier the row has out of transaction id,
+// RRN, billing order id and external id, and reports every difference found.
+// A row is never matched by a weaker identifier when its stronger one has no record,
+// e.g. a refund row with an unknown transaction id is missing in records
+// rather than matched to the purchase of the same order.
+func Reconcile(records []ReconcileRecord, rows []SettlementRow) *ReconciliationReport {
+	byKey := make([]map[string]int, 4)
+	for i := range byKey {
+		byKey[i] = map[string]int{}
+	}
+	for i, rec := range records {
+		for k, key := range []string{rec.TransactionID, rec.RRN, rec.BillingOrderID, rec.ExternalID} {
+			if _, exists := byKey[k][key]; key != "" && !exists {
+				byKey[k][key] = i
+			}
+		}
+	}
+
+	report := &ReconciliationReport{}
+	matched := make([]bool, len(records))
+	for i := range rows {
+		row := &rows[i]
+		idx := -1
+		for k, key := range []string{row.TransactionID, row.RRN, row.BillingOrderID, row.ExternalID} {
+			if key == "" {
+				continue
+			}
+			if j, ok := byKey[k][key]; ok {
+				idx = j
+			}
+			break
+		}
+		if idx < 0 {
+			report.Mismatches = append(report.Mismatches, Mismatch{Kind: MismatchMissingInRecords, Row: row})
+			continue
+		}
+
+		rec := &records[idx]
+		if matched[idx] {
+			report.Mismatches = append(report.Mismatches, Mismatch{Kind: MismatchDuplicate, Record: rec, Row: row})
+			continue
+		}
+		matched[idx] = true
+
+		clean := true
+		if rec.Amount.Amount != row.Amount.Amount || row.HasCurrency && !strings.EqualFold(rec.Amount.Currency, row.Amount.Currency) {
+			clean = false
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Kind: MismatchAmountDiffers, Record: rec, Row: row,
+				Expected: rec.Amount.String(), Actual: row.Amount.String(),
+			})
+		}
+		if row.HasFee && rec.Fee.Amount != row.Fee.Amount {
+			clean = false
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Kind: MismatchFeeDiffers, Record: rec, Row: row,
+				Expected: rec.Fee.String(), Actual: row.Fee.String(),
+			})
+		}
+		if row.Status != "" && row.Status != string(rec.Status) {
+			clean = false
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Kind: MismatchStatusDiffers, Record: rec, Row: row,
+				Expected: string(rec.Status), Actual: row.Status,
+			})
+		}
+		if clean {
+			report.Matched++
+		}
+	}
+
+	for i := range records {
+		if !matched[i] {
+			report.Mismatches = append(report.Mismatches, Mismatch{Kind: MismatchMissingInReport, Record: &records[i]})
+		}
+	}
+	return report
+}
+
+// Writes the mismatches as CSV with a header line.
+func (r *ReconciliationReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"kind", "external_id", "transaction_id", "report_line", "expected", "actual",
+	}); err != nil {
+		return err
+	}
+	for _, m := range r.Mismatches {
+		var externalID, transactionID, line string
+		if m.Record != nil {
+			externalID, transactionID = m.Record.ExternalID, m.Record.TransactionID
+		}
+		if m.Row != nil {
+			externalID = firstNonEmpty(externalID, m.Row.ExternalID)
+			transactionID = firstNonEmpty(transactionID, m.Row.TransactionID)
+			line = strconv.Itoa(m.Row.Line)
+		}
+		if err := cw.Write([]string{
+			string(m.Kind), externalID, transactionID, line, m.Expected, m.Actual,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package rozetkapay_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func readReport(t *testing.T, csv string) []rozetkapay.SettlementRow {
+	t.Helper()
+	rows, err := rozetkapay.ReadSettlementReport(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func mismatchKinds(report *rozetkapay.ReconciliationReport) []rozetkapay.MismatchKind {
+	var kinds []rozetkapay.MismatchKind
+	for _, m := range report.Mismatches {
+		kinds = append(kinds, m.Kind)
+	}
+	return kinds
+}
+
+func testRecords() []rozetkapay.ReconcileRecord {
+	return []rozetkapay.ReconcileRecord{{
+		ExternalID:    "order-1",
+		TransactionID: "tx-purchase",
+		RRN:           "rrn-1",
+		Amount:        rozetkapay.Money{Amount: 10000, Currency: "UAH"},
+		Fee:           rozetkapay.Money{Amount: 150, Currency: "UAH"},
+		Status:        rozetkapay.PaymentStatusSuccess,
+	}}
+}
+
+func TestReadSettlementReport(t *testing.T) {
+	rows := readReport(t, "Order_ID, Transaction_ID,Amount,Commission,Currency,Status,Extra\norder-1,tx-1,100.00,1.50,uah,SUCCESS,x\n")
+	if len(rows) != 1 {
+		t.Fatalf("read %d rows", len(rows))
+	}
+	row := rows[0]
+	if row.Line != 2 || row.ExternalID != "order-1" || row.TransactionID != "tx-1" || row.Status != "success" {
+		t.Fatalf("unexpected row %+v", row)
+	}
+	if row.Amount.Amount != 10000 || row.Amount.Currency != "UAH" || row.Fee.Amount != 150 || !row.HasFee || !row.HasCurrency {
+		t.Fatalf("unexpected amounts %+v", row)
+	}
+
+	rows = readReport(t, "external_id,amount\norder-1,100\n")
+	if rows[0].HasFee || rows[0].HasCurrency {
+		t.Fatalf("absent columns reported as present: %+v", rows[0])
+	}
+
+	for _, column := range []string{"rrn", "billing_order_id"} {
+		rows = readReport(t, column+",amount\nid-1,100\n")
+		if rows[0].RRN+rows[0].BillingOrderID != "id-1" {
+			t.Fatalf("%s report row %+v", column, rows[0])
+		}
+	}
+
+	if _, err := rozetkapay.ReadSettlementReport(strings.NewReader("amount,fee,currency\n100,1.50,UAH\n")); err == nil {
+		t.Fatal("report without identifier columns accepted")
+	}
+}
+
+func TestReconcileMatches(t *testing.T) {
+	rows := readReport(t, "transaction_id,amount,fee,currency,status\ntx-purchase,100.00,1.50,UAH,success\n")
+	report := rozetkapay.Reconcile(testRecords(), rows)
+	if report.Matched != 1 || len(report.Mismatches) != 0 {
+		t.Fatalf("matched %d, mismatches %v", report.Matched, mismatchKinds(report))
+	}
+}
+
+func TestReconcileUnknownTransactionIsMissingInRecords(t *testing.T) {
+	// The refund row shares the order, RRN and external id with the purchase record.
+	rows := readReport(t, "transaction_id,rrn,external_id,amount,currency\ntx-refund,rrn-1,order-1,-40.00,UAH\n")
+	report := rozetkapay.Reconcile(testRecords(), rows)
+
+	kinds := mismatchKinds(report)
+	if len(kinds) != 2 || kinds[0] != rozetkapay.MismatchMissingInRecords || kinds[1] != rozetkapay.MismatchMissingInReport {
+		t.Fatalf("mismatches %v, want missing_in_records and missing_in_report", kinds)
+	}
+}
+
+func TestReconcileFallsBackToWeakerKeys(t *testing.T) {
+	rows := readReport(t, "transaction_id,external_id,amount\n,order-1,100.00\n")
+	report := rozetkapay.Reconcile(testRecords(), rows)
+	if report.Matched != 1 || len(report.Mismatches) != 0 {
+		t.Fatalf("matched %d, mismatches %v", report.Matched, mismatchKinds(report))
+	}
+
+	report = rozetkapay.Reconcile(testRecords(), readReport(t, "rrn,amount\nrrn-1,100.00\n"))
+	if report.Matched != 1 || len(report.Mismatches) != 0 {
+		t.Fatalf("rrn only: matched %d, mismatches %v", report.Matched, mismatchKinds(report))
+	}
+}
+
+func TestReconcileSkipsAbsentColumns(t *testing.T) {
+	// Neither fee nor currency is in the report, only the amount value is compared.
+	report := rozetkapay.Reconcile(testRecords(), readReport(t, "external_id,amount\norder-1,100.00\n"))
+	if report.Matched != 1 || len(report.Mismatches) != 0 {
+		t.Fatalf("matched %d, mismatches %v", report.Matched, mismatchKinds(report))
+	}
+
+	report = rozetkapay.Reconcile(testRecords(), readReport(t, "external_id,amount,fee,currency\norder-1,100.00,2.00,USD\n"))
+	kinds := mismatchKinds(report)
+	if len(kinds) != 2 || kinds[0] != rozetkapay.MismatchAmountDiffers || kinds[1] != rozetkapay.MismatchFeeDiffers {
+		t.Fatalf("mismatches %v, want amount_differs and fee_differs", kinds)
+	}
+}
+
+func TestReconcileDuplicateAndStatus(t *testing.T) {
+	rows := readReport(t, "transaction_id,amount,status\ntx-purchase,100.00,failure\ntx-purchase,100.00,success\n")
+	report := rozetkapay.Reconcile(testRecords(), rows)
+	kinds := mismatchKinds(report)
+	if len(kinds) != 2 || kinds[0] != rozetkapay.MismatchStatusDiffers || kinds[1] != rozetkapay.MismatchDuplicate {
+		t.Fatalf("mismatches %v, want status_differs and duplicate", kinds)
+	}
+
+	var b strings.Builder
+	if err := report.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], "status_differs,order-1,tx-purchase,2,success,failure") {
+		t.Fatalf("csv:\n%s", b.String())
+	}
+}
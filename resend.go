@@ -0,0 +1,132 @@
+package rozetkapay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Returns an error unless the operation is one of the known operations or empty, which selects the last one.
+func (o CallbackResendOperation) Validate() error {
+	switch o {
+	case "", CallbackResendOperationPayment, CallbackResendOperationConfirm,
+		CallbackResendOperationCancel, CallbackResendOperationRefund:
+		return nil
+	}
+	return fmt.Errorf("invalid callback resend operation %q", o)
+}
+
+type ResendOptions struct {
+	// Number of callbacks requested at once, 1 if not set.
+	Concurrency int
+
+	// Limits the rate callbacks are requested at, in addition to any limiter of the client.
+	Limiter *RateLimiter
+}
+
+type ResendResult struct {
+	ExternalID string                  `json:"external_id"`
+	Operation  CallbackResendOperation `json:"operation,omitempty"`
+	Resent     bool                    `json:"resent"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// ResendReport lists the results in the order of the external ids.
+type ResendReport struct {
+	Results []ResendResult `json:"results"`
+}
+
+// Returns the external ids whose callbacks were resent.
+func (r *ResendReport) Succeeded() []string {
+	var ids []string
+	for _, res := range r.Results {
+		if res.Resent {
+			ids = append(ids, res.ExternalID)
+		}
+	}
+	return ids
+}
+
+// Returns the results of the callbacks that were not resent.
+func (r *ResendReport) Failed() []ResendResult {
+	var failed []ResendResult
+	for _, res := range r.Results {
+		if !res.Resent {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// CallbackResender asks the gateway to resend callbacks of many payments.
+type CallbackResender struct {
+	client *Client
+	opts   ResendOptions
+}
+
+func NewCallbackResender(client *Client, opts ResendOptions) *CallbackResender {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &CallbackResender{client: client, opts: opts}
+}
+
+// Resends the callback of the operation for every external id.
+// External ids not started before the context is done are reported as failed.
+func (r *CallbackResender) Resend(ctx context.Context, externalIDs []string, op CallbackResendOperation) (*ResendReport, error) {
+	if err := op.Validate(); err != nil {
+		return nil, err
+	}
+
+	report := &ResendReport{Results: make([]ResendResult, len(externalIDs))}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < r.opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report.Results[i] = r.resend(ctx, externalIDs[i], op)
+			}
+		}()
+	}
+	for i := range externalIDs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return report, nil
+}
+
+// Resends the callbacks of the orders the ledger recorded entries for within [from, to).
+func (r *CallbackResender) ResendRange(ctx context.Context, ledger *Ledger, from, to time.Time, op CallbackResendOperation) (*ResendReport, error) {
+	ids, err := ledger.ExternalIDs(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return r.Resend(ctx, ids, op)
+}
+
+func (r *CallbackResender) resend(ctx context.Context, externalID string, op CallbackResendOperation) ResendResult {
+	res := ResendResult{ExternalID: externalID, Operation: op}
+	if err := ctx.Err(); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if r.opts.Limiter != nil {
+		if err := r.opts.Limiter.Wait(ctx, OperationClassMutation); err != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+	if _, err := Do(ctx, r.client, ResendCallbackEndpoint, &PaymentCallbackResendSchema{
+		ExternalID: externalID,
+		Operation:  op,
+	}); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Resent = true
+	return res
+}
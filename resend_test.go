@@ -0,0 +1,59 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func TestResendReport(t *testing.T) {
+	_, c := newFakeClient(t)
+	ids := []string{"order-1", "order-2", "order-3", "missing"}
+	for _, id := range ids[:3] {
+		createDirectPayment(t, c, id, 10, "tok_visa")
+	}
+
+	report, err := rozetkapay.NewCallbackResender(c, rozetkapay.ResendOptions{Concurrency: 2}).
+		Resend(context.Background(), ids, rozetkapay.CallbackResendOperationPayment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(report.Succeeded()); got != "[order-1 order-2 order-3]" {
+		t.Fatalf("succeeded %s", got)
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0].ExternalID != "missing" || failed[0].Error == "" {
+		t.Fatalf("failed %+v", failed)
+	}
+}
+
+func TestResendCanceledContext(t *testing.T) {
+	_, c := newFakeClient(t)
+	createDirectPayment(t, c, "order-1", 10, "tok_visa")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := rozetkapay.NewCallbackResender(c, rozetkapay.ResendOptions{}).Resend(ctx, []string{"order-1"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Failed()) != 1 {
+		t.Fatalf("resent with a canceled context: %+v", report.Results)
+	}
+}
+
+func TestResendInvalidOperation(t *testing.T) {
+	_, c := newFakeClient(t)
+	if _, err := rozetkapay.NewCallbackResender(c, rozetkapay.ResendOptions{}).Resend(context.Background(), []string{"order-1"}, "chargeback"); err == nil {
+		t.Fatal("invalid operation accepted")
+	}
+}
+
+func TestResendCallbackEndpointNilSchema(t *testing.T) {
+	_, c := newFakeClient(t)
+	if _, err := rozetkapay.Do(context.Background(), c, rozetkapay.ResendCallbackEndpoint, nil); !errors.Is(err, rozetkapay.ErrNilSchema) {
+		t.Fatalf("Do with a nil schema = %v", err)
+	}
+}
@@ -0,0 +1,401 @@
+package rozetkapaytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnmatchedRequest error = errors.New("request does not match any cassette interaction")
+)
+
+const redacted = "REDACTED"
+
+// JSON fields whose values are replaced before an interaction is written to a cassette.
+var ScrubbedFields = []string{
+	"token",
+	"email",
+	"phone",
+	"first_name",
+	"last_name",
+	"patronym",
+	"address",
+	"city",
+	"postal_code",
+	"ip_address",
+	"browser_ip_address",
+	"browser_user_agent",
+	"account_number",
+}
+
+// Request headers whose values are replaced before an interaction is written to a cassette.
+var ScrubbedHeaders = []string{
+	"Authorization",
+	"Cookie",
+}
+
+// Cassette is a recorded sequence of gateway interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+
+	// Scrubbed request headers, recorded for reference and not matched on replay.
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int             `json:"status_code"`
+	Header     http.Header     `json:"header,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+
+	// Response body that is not valid JSON.
+	BodyText string `json:"body_text,omitempty"`
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// Recorder is an http.RoundTripper that passes requests to the real gateway
+// and records scrubbed request/response pairs.
+type Recorder struct {
+	path      string
+	transport http.RoundTripper
+	mu        sync.Mutex
+	cassette  Cassette
+}
+
+// Records through the transport, http.DefaultTransport if nil, into the cassette file written by Save.
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{path: path, transport: transport}
+}
+
+// Returns an HTTP client to pass to rozetkapay.WithCustomHTTPClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, out, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := cassetteRequest(req, reqBody)
+	cr.Header = requestHeader(req.Header)
+	interaction := Interaction{
+		Request: cr,
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     responseHeader(resp.Header),
+		},
+	}
+	if scrubbed, ok := scrubJSON(respBody); ok {
+		interaction.Response.Body = scrubbed
+	} else {
+		interaction.Response.BodyText = string(respBody)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// Writes the recorded interactions to the cassette file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+// Replayer is an http.RoundTripper answering requests from a cassette without network access.
+// Each interaction is replayed once, in the recorded order among equal requests.
+// Requests without a matching interaction fail with ErrUnmatchedRequest.
+type Replayer struct {
+	mu        sync.Mutex
+	cassette  *Cassette
+	used      []bool
+	unmatched []string
+}
+
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCassetteReplayer(c), nil
+}
+
+func NewCassetteReplayer(c *Cassette) *Replayer {
+	return &Replayer{cassette: c, used: make([]bool, len(c.Interactions))}
+}
+
+// Returns an HTTP client to pass to rozetkapay.WithCustomHTTPClient.
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _, err := requestBody(req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	want := cassetteRequest(req, body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !sameRequest(interaction.Request, want) {
+			continue
+		}
+		r.used[i] = true
+		resp := interaction.Response
+		respBody := []byte(resp.Body)
+		if resp.BodyText != "" {
+			respBody = []byte(resp.BodyText)
+		}
+		header := resp.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+			StatusCode:    resp.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	desc := want.Method + " " + want.Path
+	if want.Query != "" {
+		desc += "?" + want.Query
+	}
+	if len(want.Body) > 0 {
+		desc += " " + string(want.Body)
+	}
+	r.unmatched = append(r.unmatched, desc)
+	return nil, fmt.Errorf("%w: %s", ErrUnmatchedRequest, desc)
+}
+
+// Returns descriptions of the requests that did not match any interaction.
+func (r *Replayer) Unmatched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.unmatched...)
+}
+
+// Returns the interactions that were not replayed.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, used := range r.used {
+		if !used {
+			unused = append(unused, r.cassette.Interactions[i])
+		}
+	}
+	return unused
+}
+
+// Returns the request body and the request to send in place of req, leaving req itself unchanged.
+// The body is read from GetBody if set, otherwise the body is consumed
+// and a clone of the request with a fresh reader over the same bytes is returned.
+func requestBody(req *http.Request) ([]byte, *http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, req, nil
+	}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rc.Close()
+		b, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return b, req, nil
+	}
+	out := req.Clone(req.Context())
+	b, err := readBody(&out.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, out, nil
+}
+
+// Reads the body and replaces it with a fresh reader over the same bytes.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func cassetteRequest(req *http.Request, body []byte) CassetteRequest {
+	r := CassetteRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query().Encode(),
+	}
+	if scrubbed, ok := scrubJSON(body); ok {
+		r.Body = scrubbed
+	} else if len(bytes.TrimSpace(body)) > 0 {
+		r.Body, _ = json.Marshal(string(body))
+	}
+	return r
+}
+
+func sameRequest(a, b CassetteRequest) bool {
+	return a.Method == b.Method && a.Path == b.Path && a.Query == b.Query && bytes.Equal(compact(a.Body), compact(b.Body))
+}
+
+// Drops the indentation a body gets when the cassette is saved.
+func compact(b json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return b
+	}
+	return buf.Bytes()
+}
+
+// Copies the request headers under their canonical names, with the values of scrubbed ones replaced.
+func requestHeader(h http.Header) http.Header {
+	out := http.Header{}
+	for key, values := range h {
+		if isScrubbedHeader(key) {
+			values = []string{redacted}
+		}
+		for _, v := range values {
+			out.Add(key, v)
+		}
+	}
+	return out
+}
+
+func isScrubbedHeader(key string) bool {
+	for _, h := range ScrubbedHeaders {
+		if strings.EqualFold(h, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keeps only the headers relevant for decoding the response.
+func responseHeader(h http.Header) http.Header {
+	out := http.Header{}
+	for _, key := range []string{"Content-Type", "Retry-After"} {
+		if v := h.Values(key); len(v) > 0 {
+			out[key] = v
+		}
+	}
+	return out
+}
+
+// Scrubs personal data from a JSON document and re-encodes it with sorted keys,
+// so that equal documents have equal bytes.
+func scrubJSON(b []byte) (json.RawMessage, bool) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, false
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	out, err := json.Marshal(scrub(v))
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func scrub(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && s != "" && isScrubbed(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = scrub(value)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = scrub(v[i])
+		}
+	}
+	return v
+}
+
+func isScrubbed(key string) bool {
+	for _, field := range ScrubbedFields {
+		if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+	return false
+}
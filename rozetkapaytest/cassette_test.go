@@ -0,0 +1,161 @@
+package rozetkapaytest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+func directPayment(externalID string) *rozetkapay.CreatePaymentSchema {
+	return &rozetkapay.CreatePaymentSchema{
+		ExternalID: externalID,
+		Amount:     100,
+		Currency:   "UAH",
+		Mode:       rozetkapay.PaymentModeDirect,
+		Confirm:    true,
+		Customer: &rozetkapay.CustomerData{
+			Email: "payer@example.com",
+			PaymentMethod: rozetkapay.PaymentMethod{
+				Type:    rozetkapay.PaymentMethodTypeCCToken,
+				CCToken: rozetkapay.CCToken{Token: "tok_visa"},
+			},
+		},
+	}
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	srv := NewServer()
+	cfg := srv.Config()
+
+	rec := NewRecorder(path, nil)
+	c := rozetkapay.NewClient(cfg, rozetkapay.WithCustomHTTPClient(rec.Client()))
+	created, err := c.CreatePayment(directPayment("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetPaymentInfo("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cassette.Interactions) != 2 {
+		t.Fatalf("%d interactions recorded", len(cassette.Interactions))
+	}
+	create := cassette.Interactions[0].Request
+	if create.Method != http.MethodPost || !strings.HasSuffix(create.Path, "payments/v1/new") {
+		t.Fatalf("recorded request %s %s", create.Method, create.Path)
+	}
+	body := string(compact(create.Body))
+	if strings.Contains(body, "tok_visa") || strings.Contains(body, "payer@example.com") || !strings.Contains(body, `"email":"REDACTED"`) {
+		t.Fatalf("request body not scrubbed: %s", body)
+	}
+	if got := create.Header.Get("Authorization"); got != "REDACTED" {
+		t.Fatalf("authorization header recorded as %q", got)
+	}
+	if create.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("request headers %v", create.Header)
+	}
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = rozetkapay.NewClient(cfg, rozetkapay.WithCustomHTTPClient(replayer.Client()))
+	replayed, err := c.CreatePayment(directPayment("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ID != created.ID || replayed.Details.TransactionID != created.Details.TransactionID {
+		t.Fatalf("replayed payment %s/%s, recorded %s/%s", replayed.ID, replayed.Details.TransactionID, created.ID, created.Details.TransactionID)
+	}
+	if _, err := c.GetPaymentInfo("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Fatalf("%d interactions not replayed", len(unused))
+	}
+
+	// Every interaction is replayed once.
+	if _, err := c.GetPaymentInfo("order-1"); !errors.Is(err, ErrUnmatchedRequest) {
+		t.Fatalf("repeated request error = %v", err)
+	}
+	if _, err := c.GetPaymentInfo("order-2"); !errors.Is(err, ErrUnmatchedRequest) {
+		t.Fatalf("unknown request error = %v", err)
+	}
+	if unmatched := replayer.Unmatched(); len(unmatched) != 2 || !strings.Contains(unmatched[1], "external_id=order-2") {
+		t.Fatalf("unmatched %v", unmatched)
+	}
+}
+
+func TestCassetteScrubsNestedFields(t *testing.T) {
+	scrubbed, ok := scrubJSON([]byte(`{"customer":{"first_name":"Ivan","phone":""},"items":[{"token":"t"}],"amount":1.50}`))
+	if !ok {
+		t.Fatal("valid JSON not scrubbed")
+	}
+	if want := `{"amount":1.50,"customer":{"first_name":"REDACTED","phone":""},"items":[{"token":"REDACTED"}]}`; string(scrubbed) != want {
+		t.Fatalf("scrubbed %s, want %s", scrubbed, want)
+	}
+}
+
+func TestCassetteRoundTripKeepsRequest(t *testing.T) {
+	body := []byte(`{"external_id":"order-1"}`)
+	newRequest := func(getBody bool) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "http://gateway.test/payments/v1/info", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !getBody {
+			req.GetBody = nil
+		}
+		return req
+	}
+
+	var sent []byte
+	rec := NewRecorder("", roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent, _ = io.ReadAll(r.Body)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	}))
+	for _, getBody := range []bool{true, false} {
+		req := newRequest(getBody)
+		original := req.Body
+		if _, err := rec.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Body != original {
+			t.Errorf("GetBody %v: recorder replaced the request body", getBody)
+		}
+		if !bytes.Equal(sent, body) {
+			t.Errorf("GetBody %v: sent body %q", getBody, sent)
+		}
+	}
+
+	replayer := NewCassetteReplayer(&rec.cassette)
+	req := newRequest(true)
+	original := req.Body
+	if _, err := replayer.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Body != original {
+		t.Error("replayer replaced the request body")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,188 @@
+package rozetkapaytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+// Magic card tokens recognised by the server out of the box.
+const (
+	TokenInsufficientFunds = "tok_insufficient_funds"
+	TokenCardExpired       = "tok_card_expired"
+	TokenDeclined          = "tok_declined"
+	TokenTimeout           = "tok_timeout"
+	Token3DSRequired       = "tok_3ds_required"
+	TokenPending           = "tok_pending"
+	TokenGatewayError      = "tok_gateway_error"
+	TokenSlow              = "tok_slow"
+	TokenDuplicateCallback = "tok_duplicate_callback"
+)
+
+// Scenario makes the server answer a payment with a predefined outcome.
+// A scenario matches by the payment method token (for saved cards the token they were added with,
+// or the wallet option id), by the amount, or by both.
+type Scenario struct {
+	Token  string  `json:"token,omitempty"`
+	Amount float64 `json:"amount,omitempty"`
+
+	// Final status of the purchase, defaults to failure when StatusCode is set and success otherwise.
+	Status     rozetkapay.PaymentStatus     `json:"status,omitempty"`
+	StatusCode rozetkapay.PaymentStatusCode `json:"status_code,omitempty"`
+
+	// When set to an error status the request is rejected with an error response and no payment is created.
+	HTTPStatus int `json:"http_status,omitempty"`
+
+	// The purchase stays pending until the payer opens the returned checkout url (3ds verification).
+	ActionRequired bool `json:"action_required,omitempty"`
+
+	// The purchase stays pending for this long and then resolves to the final status.
+	PendingFor Duration `json:"pending_for,omitempty"`
+
+	// Delay before the response is written.
+	Latency Duration `json:"latency,omitempty"`
+
+	// Delay before the callback is sent.
+	CallbackDelay Duration `json:"callback_delay,omitempty"`
+
+	// Number of extra copies of every callback.
+	CallbackDuplicates int `json:"callback_duplicates,omitempty"`
+}
+
+// Duration is a time.Duration read from JSON strings like "1.5s" or from numbers of seconds,
+// so 2 is two seconds. It is written as a string.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	return nil
+}
+
+// Returns the scenarios behind the magic card tokens.
+func DefaultScenarios() []Scenario {
+	return []Scenario{
+		{Token: TokenInsufficientFunds, StatusCode: rozetkapay.StatusCodeInsufficientFunds},
+		{Token: TokenCardExpired, StatusCode: rozetkapay.StatusCodeCardExpired},
+		{Token: TokenDeclined, StatusCode: rozetkapay.StatusCodeTransactionDeclined},
+		{Token: TokenTimeout, StatusCode: rozetkapay.StatusCodeTimeout},
+		{Token: Token3DSRequired, StatusCode: rozetkapay.StatusCodeThreeDSRequired, ActionRequired: true},
+		{Token: TokenPending, PendingFor: Duration(2 * time.Second)},
+		{Token: TokenGatewayError, StatusCode: rozetkapay.StatusCodeInternalError, HTTPStatus: 500},
+		{Token: TokenSlow, Latency: Duration(3 * time.Second)},
+		{Token: TokenDuplicateCallback, CallbackDuplicates: 1},
+	}
+}
+
+// Adds scenarios taking precedence over the ones added before.
+func (s *Server) AddScenarios(scenarios ...Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = append(s.scenarios, scenarios...)
+}
+
+// Removes all scenarios including the default ones.
+func (s *Server) ResetScenarios() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = nil
+}
+
+// Reads a JSON array of scenarios.
+func (s *Server) LoadScenarios(r io.Reader) error {
+	var scenarios []Scenario
+	if err := json.NewDecoder(r).Decode(&scenarios); err != nil {
+		return err
+	}
+	s.AddScenarios(scenarios...)
+	return nil
+}
+
+// Reads a JSON array of scenarios from the file.
+func (s *Server) LoadScenariosFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.LoadScenarios(f)
+}
+
+func (s *Server) scenario(token string, amount float64) (Scenario, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.scenarios) - 1; i >= 0; i-- {
+		sc := s.scenarios[i]
+		if sc.Token == "" && sc.Amount == 0 {
+			continue
+		}
+		if (sc.Token == "" || sc.Token == token) && (sc.Amount == 0 || sc.Amount == amount) {
+			return sc, true
+		}
+	}
+	return Scenario{}, false
+}
+
+// Returns the final status of the purchase.
+func (sc Scenario) outcome() (rozetkapay.PaymentStatus, rozetkapay.PaymentStatusCode) {
+	status := sc.Status
+	if status == "" {
+		status = rozetkapay.PaymentStatusSuccess
+		if sc.StatusCode != "" && sc.StatusCode != rozetkapay.StatusCodeTransactionSuccessful && !sc.ActionRequired {
+			status = rozetkapay.PaymentStatusFailure
+		}
+	}
+	code := sc.StatusCode
+	if status == rozetkapay.PaymentStatusSuccess && (code == "" || sc.ActionRequired) {
+		code = rozetkapay.StatusCodeTransactionSuccessful
+	}
+	return status, code
+}
+
+func (s *Server) paymentToken(c *rozetkapay.CustomerData) string {
+	if c == nil {
+		return ""
+	}
+	m := c.PaymentMethod
+	switch m.Type {
+	case rozetkapay.PaymentMethodTypeCCToken:
+		return m.CCToken.Token
+	case rozetkapay.PaymentMethodTypeApplePay:
+		return m.ApplePay.Token
+	case rozetkapay.PaymentMethodTypeGooglePay:
+		return m.GooglePay.Token
+	case rozetkapay.PaymentMethodTypeWallet:
+		// Saved cards behave like the token they were added with.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if cust, ok := s.customers[c.ExternalID]; ok {
+			if token, ok := cust.tokens[m.Wallet.OptionID]; ok {
+				return token
+			}
+		}
+		return m.Wallet.OptionID
+	}
+	return ""
+}
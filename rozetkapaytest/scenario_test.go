@@ -0,0 +1,53 @@
+package rozetkapaytest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{`"1.5s"`, 1500 * time.Millisecond},
+		{`"250ms"`, 250 * time.Millisecond},
+		{`2`, 2 * time.Second},
+		{`0.5`, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		var d Duration
+		if err := json.Unmarshal([]byte(tt.in), &d); err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+		if time.Duration(d) != tt.want {
+			t.Errorf("%s read as %s, want %s", tt.in, time.Duration(d), tt.want)
+		}
+	}
+
+	for _, in := range []string{`"soon"`, `true`, `[1]`} {
+		var d Duration
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("%s accepted", in)
+		}
+	}
+
+	b, err := json.Marshal(Duration(1500 * time.Millisecond))
+	if err != nil || string(b) != `"1.5s"` {
+		t.Fatalf("marshaled as %s, %v", b, err)
+	}
+}
+
+func TestLoadScenariosDurations(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	if err := srv.LoadScenarios(strings.NewReader(`[{"token":"tok_wait","pending_for":3,"latency":"10ms"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	sc, ok := srv.scenario("tok_wait", 0)
+	if !ok || time.Duration(sc.PendingFor) != 3*time.Second || time.Duration(sc.Latency) != 10*time.Millisecond {
+		t.Fatalf("scenario %+v, matched %v", sc, ok)
+	}
+}
@@ -0,0 +1,1046 @@
+// Package rozetkapaytest provides an in-process fake of the RozetkaPay gateway
+// for testing code built on the rozetkapay client without network access.
+package rozetkapaytest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+const apiPrefix = "/api/"
+
+// Server is a fake RozetkaPay gateway keeping payments and customer wallets in memory.
+type Server struct {
+	*httptest.Server
+
+	// Credentials the server accepts.
+	Login    string
+	Password string
+
+	// Address where callbacks are sent when the request does not provide its own.
+	CallbackURL string
+
+	mu        sync.Mutex
+	payments  map[string]*payment
+	customers map[string]*customer
+	scenarios []Scenario
+	callbacks sync.WaitGroup
+	client    *http.Client
+}
+
+// Starts a fake gateway accepting the development credentials
+// and answering the magic card tokens with their default scenarios.
+func NewServer() *Server {
+	s := &Server{
+		Login:     rozetkapay.DevLogin,
+		Password:  rozetkapay.DevPassword,
+		payments:  map[string]*payment{},
+		customers: map[string]*customer{},
+		scenarios: DefaultScenarios(),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Returns a client config pointed at the fake gateway.
+func (s *Server) Config() *rozetkapay.Config {
+	cfg := rozetkapay.NewConfig(s.Login, s.Password)
+	cfg.API = s.URL + apiPrefix
+	cfg.CallbackURL = s.CallbackURL
+	cfg.Environment = rozetkapay.EnvironmentCustom
+	return cfg
+}
+
+// Blocks until all pending callbacks are delivered.
+func (s *Server) WaitCallbacks() {
+	s.callbacks.Wait()
+}
+
+// Waits for pending callbacks and shuts the server down.
+func (s *Server) Close() {
+	s.WaitCallbacks()
+	s.Server.Close()
+}
+
+// Returns the current state of the payment as reported by the info endpoint.
+func (s *Server) Payment(externalID string) (*rozetkapay.PaymentInfoResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.payments[externalID]
+	if !ok {
+		return nil, false
+	}
+	return p.info(), true
+}
+
+// Completes a hosted payment as if the payer finished the checkout.
+// A non-empty code fails the payment with that status code.
+func (s *Server) CompleteCheckout(externalID string, code rozetkapay.PaymentStatusCode) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.completeCheckout(s.payments[externalID], code)
+}
+
+// Completes the verification of a card being added as if the customer passed it.
+// A non-empty code fails the verification with that status code.
+func (s *Server) CompleteCardVerification(optionID string, code rozetkapay.PaymentStatusCode) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, cust := range s.customers {
+		if card, ok := cust.unverified[optionID]; ok {
+			s.verifyCard(cust, card, code)
+			return true
+		}
+	}
+	return false
+}
+
+// Saves the verified card, or drops it if code is not empty, and notifies the merchant.
+func (s *Server) verifyCard(cust *customer, card *unverifiedCard, code rozetkapay.PaymentStatusCode) {
+	delete(cust.unverified, card.entry.OptionID)
+	status := rozetkapay.PaymentStatusFailure
+	if code == "" {
+		status, code = rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful
+		cust.info.Wallet = append(cust.info.Wallet, card.entry)
+		cust.tokens[card.entry.OptionID] = card.token
+	}
+	s.sendCallback(card.callbackURL, walletCallback(cust.info.ExternalID, card.entry, status, code), 0, 0)
+}
+
+// Changes the expiry of a saved card, e.g. to test expired cards.
+func (s *Server) SetCardExpiry(customerID, optionID string, expiresAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cust, ok := s.customers[customerID]
+	if !ok {
+		return false
+	}
+	for i := range cust.info.Wallet {
+		if cust.info.Wallet[i].OptionID == optionID {
+			cust.info.Wallet[i].Card.ExpiresAt = expiresAt
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) completeCheckout(p *payment, code rozetkapay.PaymentStatusCode) bool {
+	if p == nil || !p.pending() {
+		return false
+	}
+	status := rozetkapay.PaymentStatusSuccess
+	switch {
+	case code != "":
+		status = rozetkapay.PaymentStatusFailure
+	case p.scenario != nil && !p.scenario.ActionRequired:
+		status, code = p.scenario.outcome()
+	default:
+		code = rozetkapay.StatusCodeTransactionSuccessful
+	}
+	s.resolvePurchase(p, status, code)
+	return true
+}
+
+// Moves the pending purchase to its final status and notifies the merchant.
+func (s *Server) resolvePurchase(p *payment, status rozetkapay.PaymentStatus, code rozetkapay.PaymentStatusCode) {
+	purchase := &p.purchases[0]
+	purchase.ProcessedAt = time.Now()
+	purchase.Status = status
+	purchase.StatusCode = code
+	if status == rozetkapay.PaymentStatusSuccess && !p.twoStep {
+		p.confirmations = append(p.confirmations, p.transaction(p.amount, rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful))
+	}
+	s.sendPaymentCallback(p, operationPayment, *purchase)
+}
+
+type transaction struct {
+	Amount        float64
+	Currency      string
+	PaymentID     string
+	TransactionID string
+	Status        rozetkapay.PaymentStatus
+	StatusCode    rozetkapay.PaymentStatusCode
+	Description   string
+	Payload       string
+	CreatedAt     time.Time
+	ProcessedAt   time.Time
+}
+
+const (
+	operationPayment = "payment"
+	operationConfirm = "confirm"
+	operationCancel  = "cancel"
+	operationRefund  = "refund"
+)
+
+type payment struct {
+	id          string
+	externalID  string
+	currency    string
+	amount      float64
+	twoStep     bool
+	description string
+	payload     string
+	properties  rozetkapay.Properties
+	callbackURL string
+	resultURL   string
+	checkoutURL string
+	method      rozetkapay.PaymentMethod
+	customer    rozetkapay.Recipient
+	createdAt   time.Time
+	lastOp      string
+
+	// Scenario the payment was created with, if any.
+	scenario *Scenario
+
+	purchases     []transaction
+	confirmations []transaction
+	cancellations []transaction
+	refunds       []transaction
+}
+
+type customer struct {
+	info   rozetkapay.GetWalletInfoResponse
+	tokens map[string]string
+
+	// Cards waiting for verification, keyed by option id.
+	unverified map[string]*unverifiedCard
+}
+
+type unverifiedCard struct {
+	entry       rozetkapay.WalletEntry
+	token       string
+	callbackURL string
+	resultURL   string
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/checkout/") {
+		s.checkout(w, r)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, rozetkapay.StatusCodeAuthorizationFailed, "invalid credentials", "", "")
+		return
+	}
+
+	route := r.Method + " " + strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch route {
+	case "POST payments/v1/new":
+		s.createPayment(w, r)
+	case "POST payments/v1/confirm":
+		s.confirmPayment(w, r)
+	case "POST payments/v1/cancel":
+		s.cancelPayment(w, r)
+	case "POST payments/v1/refund":
+		s.refundPayment(w, r)
+	case "GET payments/v1/info":
+		s.paymentInfo(w, r)
+	case "POST payments/v1/callback/resend":
+		s.resendCallback(w, r)
+	case "POST customers/v1/wallet":
+		s.addWalletPayment(w, r)
+	case "GET customers/v1/wallet":
+		s.walletInfo(w, r)
+	case "DELETE customers/v1/wallet":
+		s.deleteWalletPayment(w, r)
+	default:
+		writeError(w, http.StatusNotFound, rozetkapay.StatusCodeRequestFailed, "unknown endpoint "+route, "", "")
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	auth := base64.StdEncoding.EncodeToString([]byte(s.Login + ":" + s.Password))
+	return r.Header.Get("Authorization") == "Basic "+auth
+}
+
+// Opening the checkout page pays the hosted payment and redirects to its result url.
+func (s *Server) checkout(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/checkout/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.payments {
+		if p.id != id {
+			continue
+		}
+		s.completeCheckout(p, "")
+		if p.resultURL != "" {
+			http.Redirect(w, r, p.resultURL, http.StatusFound)
+			return
+		}
+		w.Write([]byte("payment completed\n"))
+		return
+	}
+	for _, cust := range s.customers {
+		card, ok := cust.unverified[id]
+		if !ok {
+			continue
+		}
+		s.verifyCard(cust, card, "")
+		if card.resultURL != "" {
+			http.Redirect(w, r, card.resultURL, http.StatusFound)
+			return
+		}
+		w.Write([]byte("card verified\n"))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) createPayment(w http.ResponseWriter, r *http.Request) {
+	var schema rozetkapay.CreatePaymentSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+	switch {
+	case schema.ExternalID == "":
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidRequestBody, "external_id is required", "external_id", "")
+		return
+	case schema.Amount <= 0:
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidTransactionAmount, "amount must be positive", "amount", "")
+		return
+	case len(schema.Currency) != 3:
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidCurrency, "currency is invalid", "currency", "")
+		return
+	case schema.Mode != rozetkapay.PaymentModeHosted && schema.Mode != rozetkapay.PaymentModeDirect:
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidRequestBody, "mode is invalid", "mode", "")
+		return
+	case schema.Mode == rozetkapay.PaymentModeDirect && (schema.Customer == nil || schema.Customer.PaymentMethod.Type == ""):
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidRequestBody, "customer payment method is required", "customer", "")
+		return
+	}
+
+	sc, matched := s.scenario(s.paymentToken(schema.Customer), schema.Amount)
+	if matched && sc.Latency > 0 {
+		time.Sleep(time.Duration(sc.Latency))
+	}
+	if matched && sc.HTTPStatus >= 300 {
+		code := sc.StatusCode
+		if code == "" {
+			code = rozetkapay.StatusCodeInternalError
+		}
+		writeError(w, sc.HTTPStatus, code, "scenario error", "", "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.payments[schema.ExternalID]; ok {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeTransactionAlreadyPaid, "payment already exists", "external_id", "")
+		return
+	}
+
+	now := time.Now()
+	p := &payment{
+		id:          randomID(),
+		externalID:  schema.ExternalID,
+		currency:    schema.Currency,
+		amount:      schema.Amount,
+		twoStep:     !schema.Confirm,
+		description: schema.Description,
+		payload:     schema.Payload,
+		properties:  schema.Properties,
+		callbackURL: firstNonEmpty(schema.CallbackURL, s.CallbackURL),
+		resultURL:   schema.ResultURL,
+		createdAt:   now,
+	}
+	if matched {
+		p.scenario = &sc
+	}
+	if schema.Customer != nil {
+		c := schema.Customer
+		p.method = c.PaymentMethod
+		p.customer = rozetkapay.Recipient{
+			Address:       c.Address,
+			City:          c.City,
+			Country:       c.Country,
+			Email:         c.Email,
+			ExternalID:    c.ExternalID,
+			FirstName:     c.FirstName,
+			LastName:      c.LastName,
+			Patronym:      c.Patronym,
+			PaymentMethod: c.PaymentMethod,
+			Phone:         c.Phone,
+			PostalCode:    c.PostalCode,
+		}
+	}
+
+	if schema.Mode == rozetkapay.PaymentModeHosted {
+		p.checkoutURL = s.URL + "/checkout/" + p.id
+		p.purchases = append(p.purchases, p.transaction(p.amount, rozetkapay.PaymentStatusPending, rozetkapay.StatusCodeWaitingForRedirect))
+		s.payments[p.externalID] = p
+		resp := p.response(operationPayment, p.purchases[0])
+		resp.ActionRequired = true
+		resp.Action = rozetkapay.PaymentUserAction{Type: "url", Value: p.checkoutURL}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	purchase := p.transaction(p.amount, rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful)
+	if code := s.checkPaymentMethod(schema.Customer); code != "" {
+		purchase.Status = rozetkapay.PaymentStatusFailure
+		purchase.StatusCode = code
+		p.scenario = nil
+	} else if matched {
+		switch {
+		case sc.ActionRequired:
+			purchase.Status = rozetkapay.PaymentStatusPending
+			purchase.StatusCode = firstNonEmptyCode(sc.StatusCode, rozetkapay.StatusCodeThreeDSRequired)
+			p.checkoutURL = s.URL + "/checkout/" + p.id
+		case sc.PendingFor > 0:
+			purchase.Status = rozetkapay.PaymentStatusPending
+			purchase.StatusCode = rozetkapay.StatusCodePending
+		default:
+			purchase.Status, purchase.StatusCode = sc.outcome()
+		}
+	}
+	p.purchases = append(p.purchases, purchase)
+	s.payments[p.externalID] = p
+
+	resp := p.response(operationPayment, purchase)
+	switch {
+	case purchase.Status == rozetkapay.PaymentStatusSuccess:
+		if !p.twoStep {
+			p.confirmations = append(p.confirmations, p.transaction(p.amount, rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful))
+		}
+		s.sendPaymentCallback(p, operationPayment, purchase)
+	case purchase.Status == rozetkapay.PaymentStatusFailure:
+		s.sendPaymentCallback(p, operationPayment, purchase)
+	case p.checkoutURL != "":
+		resp.ActionRequired = true
+		resp.Action = rozetkapay.PaymentUserAction{Type: "url", Value: p.checkoutURL}
+	default:
+		s.callbacks.Add(1)
+		time.AfterFunc(time.Duration(sc.PendingFor), func() {
+			defer s.callbacks.Done()
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if p.pending() {
+				status, code := sc.outcome()
+				s.resolvePurchase(p, status, code)
+			}
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Returns the status code the payment method is declined with, if any.
+func (s *Server) checkPaymentMethod(c *rozetkapay.CustomerData) rozetkapay.PaymentStatusCode {
+	m := c.PaymentMethod
+	switch m.Type {
+	case rozetkapay.PaymentMethodTypeCCToken:
+		if m.CCToken.Token == "" {
+			return rozetkapay.StatusCodeInvalidCardToken
+		}
+	case rozetkapay.PaymentMethodTypeApplePay:
+		if m.ApplePay.Token == "" {
+			return rozetkapay.StatusCodeInvalidToken
+		}
+	case rozetkapay.PaymentMethodTypeGooglePay:
+		if m.GooglePay.Token == "" {
+			return rozetkapay.StatusCodeInvalidToken
+		}
+	case rozetkapay.PaymentMethodTypeWallet:
+		cust, ok := s.customers[c.ExternalID]
+		if !ok {
+			return rozetkapay.StatusCodeCustomerProfileNotFound
+		}
+		entry, ok := cust.entry(m.Wallet.OptionID)
+		if !ok {
+			return rozetkapay.StatusCodePaymentMethodNotFound
+		}
+		if entry.Card.ExpiresAt.Before(time.Now()) {
+			return rozetkapay.StatusCodeCardExpired
+		}
+	default:
+		return rozetkapay.StatusCodePaymentMethodNotAllowed
+	}
+	return ""
+}
+
+func (s *Server) confirmPayment(w http.ResponseWriter, r *http.Request) {
+	var schema rozetkapay.ConfirmPaymentSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.purchasedPayment(w, schema.ExternalID)
+	if !ok {
+		return
+	}
+	if !p.twoStep {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeActionNotAllowed, "payment is one-step", "", p.id)
+		return
+	}
+	remaining := p.amount - p.sum(p.confirmations) - p.sum(p.cancellations)
+	if remaining <= 0 {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeActionAlreadyDone, "payment is already confirmed or canceled", "", p.id)
+		return
+	}
+	amount := schema.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if !s.checkAmount(w, p, amount, remaining, schema.Currency, rozetkapay.StatusCodeConfirmAmountCannotBeMoreThanTheTransactionAmount) {
+		return
+	}
+
+	confirmation := p.transaction(amount, rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful)
+	confirmation.Payload = schema.Payload
+	p.confirmations = append(p.confirmations, confirmation)
+	p.callbackURL = firstNonEmpty(schema.CallbackURL, p.callbackURL)
+	s.sendPaymentCallback(p, operationConfirm, confirmation)
+	writeJSON(w, http.StatusOK, p.response(operationConfirm, confirmation))
+}
+
+func (s *Server) cancelPayment(w http.ResponseWriter, r *http.Request) {
+	var schema rozetkapay.CancelPaymentSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.purchasedPayment(w, schema.ExternalID)
+	if !ok {
+		return
+	}
+	if !p.twoStep || len(p.confirmations) > 0 {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeActionNotAllowed, "only unconfirmed two-step payments can be canceled", "", p.id)
+		return
+	}
+	remaining := p.amount - p.sum(p.cancellations)
+	if remaining <= 0 {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeActionAlreadyDone, "payment is already canceled", "", p.id)
+		return
+	}
+	amount := schema.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if !s.checkAmount(w, p, amount, remaining, schema.Currency, rozetkapay.StatusCodeWrongAmount) {
+		return
+	}
+
+	cancellation := p.transaction(amount, rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful)
+	cancellation.Payload = schema.Payload
+	p.cancellations = append(p.cancellations, cancellation)
+	p.callbackURL = firstNonEmpty(schema.CallbackURL, p.callbackURL)
+	s.sendPaymentCallback(p, operationCancel, cancellation)
+	writeJSON(w, http.StatusOK, p.response(operationCancel, cancellation))
+}
+
+func (s *Server) refundPayment(w http.ResponseWriter, r *http.Request) {
+	var schema rozetkapay.RefundPaymentSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.purchasedPayment(w, schema.ExternalID)
+	if !ok {
+		return
+	}
+	refundable := p.sum(p.confirmations) - p.sum(p.refunds)
+	if len(p.confirmations) == 0 {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeActionNotAllowed, "payment is not confirmed", "", p.id)
+		return
+	}
+	if refundable <= 0 {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodePaymentWasRefunded, "payment is already refunded", "", p.id)
+		return
+	}
+	amount := schema.Amount
+	if amount == 0 {
+		amount = refundable
+	}
+	if !s.checkAmount(w, p, amount, refundable, schema.Currency, rozetkapay.StatusCodeIncorrectRefundSumOrCurrency) {
+		return
+	}
+
+	refund := p.transaction(amount, rozetkapay.PaymentStatusSuccess, rozetkapay.StatusCodeTransactionSuccessful)
+	refund.Payload = schema.Payload
+	p.refunds = append(p.refunds, refund)
+	p.callbackURL = firstNonEmpty(schema.CallbackURL, p.callbackURL)
+	s.sendPaymentCallback(p, operationRefund, refund)
+	writeJSON(w, http.StatusOK, p.response(operationRefund, refund))
+}
+
+func (s *Server) paymentInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[r.URL.Query().Get("external_id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, rozetkapay.StatusCodeTransactionNotFound, "payment not found", "external_id", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.info())
+}
+
+func (s *Server) resendCallback(w http.ResponseWriter, r *http.Request) {
+	var schema rozetkapay.PaymentCallbackResendSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[schema.ExternalID]
+	if !ok {
+		writeError(w, http.StatusNotFound, rozetkapay.StatusCodeTransactionNotFound, "payment not found", "external_id", "")
+		return
+	}
+	op := string(schema.Operation)
+	if op == "" {
+		op = p.lastOp
+	}
+	txs := p.transactions(op)
+	if len(txs) == 0 {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeTransactionNotFound, "no "+op+" transaction to resend", "operation", p.id)
+		return
+	}
+	s.sendPaymentCallback(p, op, txs[len(txs)-1])
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) addWalletPayment(w http.ResponseWriter, r *http.Request) {
+	customerID := r.URL.Query().Get("external_id")
+	var schema rozetkapay.AddWalletCustomerSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+	if customerID == "" {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeCustomerIDNotPassed, "external_id is required", "external_id", "")
+		return
+	}
+	token := schema.PaymentMethod.CCToken.Token
+	if schema.PaymentMethod.Type != rozetkapay.PaymentMethodTypeCCToken || token == "" {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidCardToken, "cc_token payment method is required", "payment_method", "")
+		return
+	}
+
+	sc, matched := s.scenario(token, 0)
+	if matched && sc.HTTPStatus >= 300 {
+		writeError(w, sc.HTTPStatus, firstNonEmptyCode(sc.StatusCode, rozetkapay.StatusCodeInternalError), "scenario error", "", "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust, ok := s.customers[customerID]
+	if !ok {
+		cust = &customer{
+			info:       rozetkapay.GetWalletInfoResponse{ExternalID: customerID, RID: randomID()},
+			tokens:     map[string]string{},
+			unverified: map[string]*unverifiedCard{},
+		}
+		s.customers[customerID] = cust
+	}
+
+	entry := rozetkapay.WalletEntry{
+		Card: rozetkapay.Card{
+			ExpiresAt: time.Now().AddDate(3, 0, 0).UTC().Truncate(24 * time.Hour),
+			Mask:      cardMask(token),
+		},
+		OptionID: randomID(),
+		Name:     "Card " + cardMask(token)[12:],
+		Type:     string(rozetkapay.PaymentMethodTypeCCToken),
+	}
+	callbackURL := firstNonEmpty(schema.CallbackURL, s.CallbackURL)
+	resp := rozetkapay.AddWalletCustomerResponse{
+		CreatedAt:     time.Now(),
+		PaymentMethod: rozetkapay.AddWalletCustomerPaymentMethod(entry),
+		Status:        rozetkapay.PaymentStatusSuccess,
+	}
+	switch {
+	case matched && sc.ActionRequired:
+		// The card is saved once the customer passes the verification.
+		cust.unverified[entry.OptionID] = &unverifiedCard{
+			entry:       entry,
+			token:       token,
+			callbackURL: callbackURL,
+			resultURL:   schema.ResultURL,
+		}
+		resp.Status = rozetkapay.PaymentStatusPending
+		resp.ActionRequired = true
+		resp.Action = rozetkapay.PaymentUserAction{Type: "url", Value: s.URL + "/checkout/" + entry.OptionID}
+	case matched && cardRejected[sc.StatusCode]:
+		resp.Status = rozetkapay.PaymentStatusFailure
+		s.sendCallback(callbackURL, walletCallback(customerID, entry, resp.Status, sc.StatusCode), 0, 0)
+	default:
+		cust.info.Wallet = append(cust.info.Wallet, entry)
+		cust.tokens[entry.OptionID] = token
+		s.sendCallback(callbackURL, walletCallback(customerID, entry, resp.Status, rozetkapay.StatusCodeTransactionSuccessful), 0, 0)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Status codes that fail adding the card, other declines only show up when the card is charged.
+var cardRejected = map[rozetkapay.PaymentStatusCode]bool{
+	rozetkapay.StatusCodeCardExpired:         true,
+	rozetkapay.StatusCodeTransactionDeclined: true,
+	rozetkapay.StatusCodeInvalidCardToken:    true,
+}
+
+func walletCallback(customerID string, entry rozetkapay.WalletEntry, status rozetkapay.PaymentStatus, code rozetkapay.PaymentStatusCode) rozetkapay.WalletCallback {
+	return rozetkapay.WalletCallback{
+		ExternalID:    customerID,
+		CreatedAt:     time.Now(),
+		PaymentMethod: rozetkapay.AddWalletCustomerPaymentMethod(entry),
+		Status:        status,
+		StatusCode:    code,
+	}
+}
+
+func (s *Server) walletInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust, ok := s.customers[r.URL.Query().Get("external_id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, rozetkapay.StatusCodeCustomerProfileNotFound, "customer not found", "external_id", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, cust.info)
+}
+
+func (s *Server) deleteWalletPayment(w http.ResponseWriter, r *http.Request) {
+	var schema rozetkapay.DeleteWalletCustomerSchema
+	if !decode(w, r, &schema) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust, ok := s.customers[r.URL.Query().Get("external_id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, rozetkapay.StatusCodeCustomerProfileNotFound, "customer not found", "external_id", "")
+		return
+	}
+	for i, entry := range cust.info.Wallet {
+		if entry.OptionID == schema.OptionID {
+			cust.info.Wallet = append(cust.info.Wallet[:i], cust.info.Wallet[i+1:]...)
+			delete(cust.tokens, entry.OptionID)
+			writeJSON(w, http.StatusOK, rozetkapay.DeleteWalletCustomerResponse{
+				Delete:   true,
+				OptionID: entry.OptionID,
+				Type:     rozetkapay.PaymentMethodType(entry.Type),
+			})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, rozetkapay.StatusCodePaymentMethodNotFound, "payment method not found", "option_id", "")
+}
+
+// Looks up a payment whose purchase succeeded, writing the error response otherwise.
+func (s *Server) purchasedPayment(w http.ResponseWriter, externalID string) (*payment, bool) {
+	p, ok := s.payments[externalID]
+	if !ok {
+		writeError(w, http.StatusNotFound, rozetkapay.StatusCodeTransactionNotFound, "payment not found", "external_id", "")
+		return nil, false
+	}
+	if len(p.purchases) == 0 || p.purchases[len(p.purchases)-1].Status != rozetkapay.PaymentStatusSuccess {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeTransactionSuccessPrimaryNotFound, "payment is not paid", "", p.id)
+		return nil, false
+	}
+	return p, true
+}
+
+func (s *Server) checkAmount(
+	w http.ResponseWriter, p *payment, amount, limit float64, currency string, code rozetkapay.PaymentStatusCode,
+) bool {
+	if currency != "" && currency != p.currency {
+		writeError(w, http.StatusBadRequest, code, "currency does not match the payment", "currency", p.id)
+		return false
+	}
+	if amount < 0 || amount > limit+0.000001 {
+		writeError(w, http.StatusBadRequest, code, "amount exceeds "+formatAmount(limit), "amount", p.id)
+		return false
+	}
+	return true
+}
+
+func (s *Server) sendPaymentCallback(p *payment, op string, tx transaction) {
+	p.lastOp = op
+	var delay time.Duration
+	var duplicates int
+	if p.scenario != nil {
+		delay = time.Duration(p.scenario.CallbackDelay)
+		duplicates = p.scenario.CallbackDuplicates
+	}
+	s.sendCallback(p.callbackURL, p.response(op, tx), delay, duplicates)
+}
+
+// Posts the callback in the background, after the delay and as many extra times as duplicates.
+func (s *Server) sendCallback(url string, v interface{}, delay time.Duration, duplicates int) {
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[RozetkaPay] Error --- type: %s, message: %s\n", "fake_callback", err)
+		return
+	}
+	s.callbacks.Add(1)
+	go func() {
+		defer s.callbacks.Done()
+		time.Sleep(delay)
+		for i := 0; i <= duplicates; i++ {
+			resp, err := s.client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				log.Printf("[RozetkaPay] Error --- type: %s, url: %s, message: %s\n", "fake_callback", url, err)
+				return
+			}
+			resp.Body.Close()
+		}
+	}()
+}
+
+func (p *payment) transaction(amount float64, status rozetkapay.PaymentStatus, code rozetkapay.PaymentStatusCode) transaction {
+	now := time.Now()
+	return transaction{
+		Amount:        amount,
+		Currency:      p.currency,
+		PaymentID:     p.id,
+		TransactionID: randomID(),
+		Status:        status,
+		StatusCode:    code,
+		Description:   p.description,
+		Payload:       p.payload,
+		CreatedAt:     now,
+		ProcessedAt:   now,
+	}
+}
+
+func (p *payment) pending() bool {
+	return len(p.purchases) > 0 && p.purchases[0].Status == rozetkapay.PaymentStatusPending
+}
+
+func (p *payment) transactions(op string) []transaction {
+	switch op {
+	case operationPayment:
+		return p.purchases
+	case operationConfirm:
+		return p.confirmations
+	case operationCancel:
+		return p.cancellations
+	case operationRefund:
+		return p.refunds
+	}
+	return nil
+}
+
+// Sums the amounts of successful transactions.
+func (p *payment) sum(txs []transaction) float64 {
+	var total float64
+	for _, tx := range txs {
+		if tx.Status == rozetkapay.PaymentStatusSuccess {
+			total += tx.Amount
+		}
+	}
+	return total
+}
+
+func (p *payment) response(op string, tx transaction) rozetkapay.PaymentResponse {
+	return rozetkapay.PaymentResponse{
+		ID: p.id,
+		Details: rozetkapay.PaymentResponseDetails{
+			Amount:            formatAmount(tx.Amount),
+			BillingOrderID:    tx.TransactionID,
+			CreatedAt:         tx.CreatedAt,
+			Currency:          tx.Currency,
+			Description:       tx.Description,
+			GatewayOrderID:    op + "-" + tx.TransactionID,
+			Payload:           tx.Payload,
+			PaymentID:         tx.PaymentID,
+			ProcessedAt:       tx.ProcessedAt,
+			Properties:        p.properties,
+			RRN:               tx.TransactionID[:12],
+			Status:            tx.Status,
+			StatusCode:        tx.StatusCode,
+			StatusDescription: strings.Replace(string(tx.StatusCode), "_", " ", -1),
+			TransactionID:     tx.TransactionID,
+			Fee:               rozetkapay.PaymentResponseDetailsFee{Amount: "0.00", Currency: tx.Currency},
+			TerminalName:      "rozetkapaytest",
+		},
+		ExternalID:    p.externalID,
+		IsSuccess:     tx.Status == rozetkapay.PaymentStatusSuccess,
+		ReceiptURL:    p.checkoutURL,
+		PaymentMethod: p.method,
+		Customer: rozetkapay.PaymentResponseCustomer{
+			Email:      p.customer.Email,
+			ExternalID: p.customer.ExternalID,
+			FirstName:  p.customer.FirstName,
+			LastName:   p.customer.LastName,
+			Patronym:   p.customer.Patronym,
+			Phone:      p.customer.Phone,
+		},
+	}
+}
+
+func (p *payment) info() *rozetkapay.PaymentInfoResponse {
+	info := &rozetkapay.PaymentInfoResponse{
+		Amount:          formatAmount(p.amount),
+		AmountCanceled:  formatAmount(p.sum(p.cancellations)),
+		AmountConfirmed: formatAmount(p.sum(p.confirmations)),
+		AmountRefunded:  formatAmount(p.sum(p.refunds)),
+		Canceled:        p.sum(p.cancellations) > 0,
+		Confirmed:       p.sum(p.confirmations) > 0,
+		CreatedAt:       p.createdAt,
+		Currency:        p.currency,
+		ExternalID:      p.externalID,
+		ID:              p.id,
+		Purchased:       p.sum(p.purchases) > 0,
+		ReceiptURL:      p.checkoutURL,
+		Refunded:        p.sum(p.refunds) > 0,
+		Customer:        p.customer,
+	}
+	if p.pending() && p.checkoutURL != "" {
+		info.ActionRequired = true
+		info.Action = rozetkapay.PaymentUserAction{Type: "url", Value: p.checkoutURL}
+	}
+	for _, tx := range p.purchases {
+		info.PurchaseDetails = append(info.PurchaseDetails, p.detail(tx))
+	}
+	for _, tx := range p.confirmations {
+		info.ConfirmationDetails = append(info.ConfirmationDetails, rozetkapay.ConfirmationDetail(p.detail(tx)))
+	}
+	for _, tx := range p.cancellations {
+		info.CancellationDetails = append(info.CancellationDetails, rozetkapay.CancellationDetail(p.detail(tx)))
+	}
+	for _, tx := range p.refunds {
+		info.RefundDetails = append(info.RefundDetails, rozetkapay.RefundDetail(p.detail(tx)))
+	}
+	return info
+}
+
+func (p *payment) detail(tx transaction) rozetkapay.PurchaseDetail {
+	return rozetkapay.PurchaseDetail{
+		Amount:            formatAmount(tx.Amount),
+		BillingOrderID:    tx.TransactionID,
+		CreatedAt:         tx.CreatedAt,
+		Currency:          tx.Currency,
+		Description:       tx.Description,
+		Payload:           tx.Payload,
+		PaymentID:         tx.PaymentID,
+		ProcessedAt:       tx.ProcessedAt,
+		Properties:        p.properties,
+		RRN:               tx.TransactionID[:12],
+		Status:            string(tx.Status),
+		StatusCode:        string(tx.StatusCode),
+		StatusDescription: strings.Replace(string(tx.StatusCode), "_", " ", -1),
+		TransactionID:     tx.TransactionID,
+		Fee:               rozetkapay.Fee{Amount: "0.00", Currency: tx.Currency},
+		TerminalName:      "rozetkapaytest",
+	}
+}
+
+func (c *customer) entry(optionID string) (rozetkapay.WalletEntry, bool) {
+	for _, entry := range c.info.Wallet {
+		if entry.OptionID == optionID {
+			return entry, true
+		}
+	}
+	return rozetkapay.WalletEntry{}, false
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, rozetkapay.StatusCodeInvalidRequestBody, err.Error(), "", "")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[RozetkaPay] Error --- type: %s, message: %s\n", "fake_response", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code rozetkapay.PaymentStatusCode, message, param, paymentID string) {
+	typ := "invalid_request_error"
+	switch {
+	case status == http.StatusUnauthorized:
+		typ = "authentication_error"
+	case status >= 500:
+		typ = "api_error"
+	case paymentID != "":
+		typ = "payment_error"
+	}
+	writeJSON(w, status, rozetkapay.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Param:     param,
+		PaymentID: paymentID,
+		Type:      typ,
+	})
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// Derives a stable masked card number from the token.
+func cardMask(token string) string {
+	var sum uint32
+	for _, b := range []byte(token) {
+		sum = sum*31 + uint32(b)
+	}
+	last4 := strconv.Itoa(int(sum%10000) + 10000)[1:]
+	return "424242******" + last4
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonEmptyCode(codes ...rozetkapay.PaymentStatusCode) rozetkapay.PaymentStatusCode {
+	for _, c := range codes {
+		if c != "" {
+			return c
+		}
+	}
+	return ""
+}
@@ -0,0 +1,477 @@
+package rozetkapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSubscriptionNotFound error = errors.New("subscription not found")
+)
+
+type IntervalUnit string
+
+const (
+	IntervalDay   IntervalUnit = "day"
+	IntervalWeek  IntervalUnit = "week"
+	IntervalMonth IntervalUnit = "month"
+	IntervalYear  IntervalUnit = "year"
+)
+
+// PlanInterval is the billing period of a plan, e.g. every 3 months.
+type PlanInterval struct {
+	Unit  IntervalUnit `json:"unit"`
+	Count int          `json:"count"`
+}
+
+// Returns the start of the period following t.
+func (i PlanInterval) Next(t time.Time) time.Time {
+	n := i.Count
+	if n <= 0 {
+		n = 1
+	}
+	switch i.Unit {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7*n)
+	case IntervalMonth:
+		return t.AddDate(0, n, 0)
+	case IntervalYear:
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+type Plan struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Amount   Money        `json:"amount"`
+	Interval PlanInterval `json:"interval"`
+}
+
+func (p Plan) validate() error {
+	if p.Amount.Amount <= 0 || p.Amount.Currency == "" {
+		return fmt.Errorf("plan %s: invalid amount %s", p.ID, p.Amount)
+	}
+	switch p.Interval.Unit {
+	case IntervalDay, IntervalWeek, IntervalMonth, IntervalYear:
+	default:
+		return fmt.Errorf("plan %s: invalid interval unit %q", p.ID, p.Interval.Unit)
+	}
+	return nil
+}
+
+type SubscriptionStatus string
+
+const (
+	// Charged for the current period or waiting for the first charge.
+	SubscriptionStatusActive SubscriptionStatus = "active"
+
+	// The last charge was declined and is retried according to the dunning schedule.
+	SubscriptionStatusPastDue SubscriptionStatus = "past_due"
+
+	// Dunning is exhausted or the card cannot be charged again, the customer has to update the payment option.
+	SubscriptionStatusUnpaid SubscriptionStatus = "unpaid"
+
+	SubscriptionStatusCanceled SubscriptionStatus = "canceled"
+)
+
+type Subscription struct {
+	ID         string             `json:"id"`
+	CustomerID string             `json:"customer_id"`
+	OptionID   string             `json:"option_id"`
+	Plan       Plan               `json:"plan"`
+	Status     SubscriptionStatus `json:"status"`
+
+	// Number of periods charged so far.
+	Period int `json:"period"`
+
+	// Number of declined charges of the current period.
+	FailedAttempts int `json:"failed_attempts"`
+
+	// Number of charges that reached a decision, successful or declined.
+	Charges int `json:"charges"`
+
+	NextChargeAt   time.Time         `json:"next_charge_at"`
+	PaidUntil      time.Time         `json:"paid_until"`
+	LastExternalID string            `json:"last_external_id,omitempty"`
+	LastStatusCode PaymentStatusCode `json:"last_status_code,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// Returns the external id of the next charge.
+// Repeating a charge after a crash reuses the id, so the gateway never charges twice.
+func (s Subscription) chargeExternalID() string {
+	return fmt.Sprintf("%s-%d", s.ID, s.Charges+1)
+}
+
+// SubscriptionStore persists subscriptions.
+type SubscriptionStore interface {
+	Save(sub Subscription) error
+
+	// Returns ErrSubscriptionNotFound if there is no such subscription.
+	Get(id string) (Subscription, error)
+
+	// Returns up to limit active or past due subscriptions with a charge due at the given time.
+	Due(now time.Time, limit int) ([]Subscription, error)
+}
+
+// MemorySubscriptionStore keeps subscriptions in memory.
+type MemorySubscriptionStore struct {
+	mu            sync.Mutex
+	subscriptions map[string]Subscription
+}
+
+func NewMemorySubscriptionStore() *MemorySubscriptionStore {
+	return &MemorySubscriptionStore{subscriptions: map[string]Subscription{}}
+}
+
+func (s *MemorySubscriptionStore) Save(sub Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions[sub.ID] = sub
+	return nil
+}
+
+func (s *MemorySubscriptionStore) Get(id string) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func (s *MemorySubscriptionStore) Due(now time.Time, limit int) ([]Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Subscription
+	for _, sub := range s.subscriptions {
+		if sub.Status != SubscriptionStatusActive && sub.Status != SubscriptionStatusPastDue {
+			continue
+		}
+		if !sub.NextChargeAt.After(now) {
+			due = append(due, sub)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextChargeAt.Before(due[j].NextChargeAt) })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Status codes after which charging the same payment option again makes no sense.
+var subscriptionFinalCodes = map[PaymentStatusCode]bool{
+	StatusCodeCardExpired:                     true,
+	StatusCodeCardNotSupported:                true,
+	StatusCodeRecurringTransactionsNotAllowed: true,
+	StatusCodeTransactionIsNotRecurring:       true,
+	StatusCodePaymentMethodNotFound:           true,
+	StatusCodeCustomerProfileNotFound:         true,
+}
+
+// Status codes of error responses that decline the charge of the customer's payment option.
+// Other error responses, e.g. authorization_failed or invalid_request_body, point to a problem
+// of the merchant setup and do not move subscriptions into dunning.
+var subscriptionDeclineCodes = map[PaymentStatusCode]bool{
+	StatusCodeInsufficientFunds:           true,
+	StatusCodeTransactionDeclined:         true,
+	StatusCodeTransactionRejected:         true,
+	StatusCodeAuthorizationError:          true,
+	StatusCodeAntiFraudCheck:              true,
+	StatusCodeThreeDSRequired:             true,
+	StatusCodeThreeDSNotSupported:         true,
+	StatusCodeCardVerificationRequired:    true,
+	StatusCodeFailedToVerifyCard:          true,
+	StatusCodeCVVIsRequired:               true,
+	StatusCodeWrongCVV:                    true,
+	StatusCodePINTRIESExceeded:            true,
+	StatusCodeInvalidCardData:             true,
+	StatusCodeInvalidCardToken:            true,
+	StatusCodeCardNotFound:                true,
+	StatusCodeCardHasConstraints:          true,
+	StatusCodeCardTypeIsNotSupported:      true,
+	StatusCodePaymentCardHasInvalidStatus: true,
+	StatusCodeTransactionAmountLimit:      true,
+	StatusCodeTransactionLimitExceeded:    true,
+	StatusCodeDailyCardUsageLimitReached:  true,
+	StatusCodeCardBranchIsBlocked:         true,
+	StatusCodeCardBranchDailyLimitReached: true,
+}
+
+func isSubscriptionDecline(code PaymentStatusCode) bool {
+	return subscriptionDeclineCodes[code] || subscriptionFinalCodes[code]
+}
+
+// DefaultDunningSchedule retries a declined charge after one, three and seven days.
+var DefaultDunningSchedule = []time.Duration{24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour}
+
+type SchedulerOptions struct {
+	// Delays before retrying a declined charge, DefaultDunningSchedule if not set.
+	// The subscription becomes unpaid once the schedule is exhausted.
+	Dunning []time.Duration
+
+	// Delay before retrying a charge that failed on the gateway side or is still pending, a minute if not set.
+	RetryDelay time.Duration
+
+	// Number of subscriptions charged per run, 100 if not set.
+	BatchSize int
+
+	// Interval Run polls the store at, a minute if not set.
+	PollInterval time.Duration
+
+	// Called after a period is charged. The response is nil when the charge was created by an earlier run
+	// and its outcome was found through the payment info, see Subscription.LastExternalID.
+	OnCharged func(sub Subscription, resp *PaymentResponse)
+
+	// Called after a charge is declined.
+	OnDeclined func(sub Subscription, code PaymentStatusCode)
+
+	// Called after the subscription status changes.
+	OnStatusChanged func(sub Subscription, from SubscriptionStatus)
+}
+
+// SubscriptionScheduler charges subscriptions using the customer's saved wallet option.
+type SubscriptionScheduler struct {
+	client *Client
+	store  SubscriptionStore
+	opts   SchedulerOptions
+}
+
+func NewSubscriptionScheduler(client *Client, store SubscriptionStore, opts SchedulerOptions) *SubscriptionScheduler {
+	if opts.Dunning == nil {
+		opts.Dunning = DefaultDunningSchedule
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Minute
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Minute
+	}
+	return &SubscriptionScheduler{client: client, store: store, opts: opts}
+}
+
+// Subscribes the customer to the plan, the first period is charged at start.
+func (s *SubscriptionScheduler) Subscribe(customerID, optionID string, plan Plan, start time.Time) (Subscription, error) {
+	if customerID == "" || optionID == "" {
+		return Subscription{}, errors.New("subscription customer and option ids are required")
+	}
+	if err := plan.validate(); err != nil {
+		return Subscription{}, err
+	}
+	now := time.Now()
+	sub := Subscription{
+		ID:           randomHex(12),
+		CustomerID:   customerID,
+		OptionID:     optionID,
+		Plan:         plan,
+		Status:       SubscriptionStatusActive,
+		NextChargeAt: start,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.store.Save(sub); err != nil {
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+// Cancels the subscription, the paid period is not refunded.
+func (s *SubscriptionScheduler) Cancel(id string) (Subscription, error) {
+	sub, err := s.store.Get(id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	return sub, s.setStatus(&sub, SubscriptionStatusCanceled)
+}
+
+// Replaces the payment option of the subscription.
+// Past due and unpaid subscriptions are charged again right away.
+func (s *SubscriptionScheduler) UpdatePaymentOption(id, optionID string) (Subscription, error) {
+	sub, err := s.store.Get(id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if sub.Status == SubscriptionStatusCanceled {
+		return Subscription{}, fmt.Errorf("subscription %s is canceled", id)
+	}
+	sub.OptionID = optionID
+	if sub.Status != SubscriptionStatusActive {
+		sub.FailedAttempts = 0
+		sub.NextChargeAt = time.Now()
+		return sub, s.setStatus(&sub, SubscriptionStatusPastDue)
+	}
+	sub.UpdatedAt = time.Now()
+	return sub, s.store.Save(sub)
+}
+
+// Charges subscriptions until the context is done.
+func (s *SubscriptionScheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.ChargeDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[RozetkaPay] Error --- type: %s, message: %s\n", "subscription", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Charges the subscriptions due now and returns how many were processed.
+// Errors not caused by the payment option, e.g. rejected credentials, stop the run
+// and leave the subscription status and failed attempts as they are.
+func (s *SubscriptionScheduler) ChargeDue(ctx context.Context) (int, error) {
+	due, err := s.store.Due(time.Now(), s.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i, sub := range due {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := s.charge(ctx, sub); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+func (s *SubscriptionScheduler) charge(ctx context.Context, sub Subscription) error {
+	externalID := sub.chargeExternalID()
+	status, code, resp, err := s.createCharge(ctx, sub, externalID)
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) && !isGatewayFailure(errResp.HTTPStatus, err) {
+		// Rejected for a reason other than the payment option, the subscription keeps its status
+		// and is charged again after the retry delay.
+		sub.NextChargeAt = time.Now().Add(s.opts.RetryDelay)
+		sub.UpdatedAt = time.Now()
+		if serr := s.store.Save(sub); serr != nil {
+			return serr
+		}
+		return fmt.Errorf("subscription %s: %w", sub.ID, err)
+	}
+	if err != nil {
+		// The charge did not reach a decision, try the same charge again later.
+		log.Printf("[RozetkaPay] Error --- type: %s, subscription: %s, message: %s\n", "subscription", sub.ID, err)
+		sub.NextChargeAt = time.Now().Add(s.opts.RetryDelay)
+		sub.UpdatedAt = time.Now()
+		return s.store.Save(sub)
+	}
+
+	switch status {
+	case PaymentStatusSuccess:
+		// A period charged after dunning starts at the successful retry.
+		periodStart := maxTime(sub.PaidUntil, sub.NextChargeAt)
+		sub.Charges++
+		sub.LastExternalID, sub.LastStatusCode = externalID, code
+		sub.Period++
+		sub.FailedAttempts = 0
+		sub.PaidUntil = sub.Plan.Interval.Next(periodStart)
+		sub.NextChargeAt = sub.PaidUntil
+		if err := s.setStatus(&sub, SubscriptionStatusActive); err != nil {
+			return err
+		}
+		if s.opts.OnCharged != nil {
+			s.opts.OnCharged(sub, resp)
+		}
+		return nil
+	case PaymentStatusFailure:
+		sub.Charges++
+		sub.LastExternalID, sub.LastStatusCode = externalID, code
+		sub.FailedAttempts++
+		next := SubscriptionStatusPastDue
+		if subscriptionFinalCodes[code] || sub.FailedAttempts > len(s.opts.Dunning) {
+			next = SubscriptionStatusUnpaid
+		} else {
+			sub.NextChargeAt = time.Now().Add(s.opts.Dunning[sub.FailedAttempts-1])
+		}
+		if err := s.setStatus(&sub, next); err != nil {
+			return err
+		}
+		if s.opts.OnDeclined != nil {
+			s.opts.OnDeclined(sub, code)
+		}
+		return nil
+	}
+
+	// Still pending, the next run looks the charge up by its external id.
+	sub.NextChargeAt = time.Now().Add(s.opts.RetryDelay)
+	sub.UpdatedAt = time.Now()
+	return s.store.Save(sub)
+}
+
+// Creates the charge, or looks it up if it was already created by an earlier run.
+func (s *SubscriptionScheduler) createCharge(ctx context.Context, sub Subscription, externalID string) (PaymentStatus, PaymentStatusCode, *PaymentResponse, error) {
+	resp, err := Do(ctx, s.client, CreatePaymentEndpoint, &CreatePaymentSchema{
+		Amount:      sub.Plan.Amount.Float64(),
+		Currency:    sub.Plan.Amount.Currency,
+		ExternalID:  externalID,
+		Mode:        PaymentModeDirect,
+		Confirm:     true,
+		Description: sub.Plan.Name,
+		Customer: &CustomerData{
+			ExternalID: sub.CustomerID,
+			PaymentMethod: PaymentMethod{
+				Type:   PaymentMethodTypeWallet,
+				Wallet: Wallet{OptionID: sub.OptionID},
+			},
+		},
+	})
+	if err == nil {
+		return resp.Details.Status, resp.Details.StatusCode, resp, nil
+	}
+	code, ok := ErrorStatusCode(err)
+	if !ok {
+		return "", "", nil, err
+	}
+	if code != StatusCodeTransactionAlreadyPaid {
+		if !isSubscriptionDecline(code) {
+			return "", "", nil, err
+		}
+		return PaymentStatusFailure, code, nil, nil
+	}
+
+	info, err := Do(ctx, s.client, PaymentInfoEndpoint, externalID)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if len(info.PurchaseDetails) == 0 {
+		return PaymentStatusPending, "", nil, nil
+	}
+	last := info.PurchaseDetails[len(info.PurchaseDetails)-1]
+	return PaymentStatus(last.Status), PaymentStatusCode(last.StatusCode), nil, nil
+}
+
+func (s *SubscriptionScheduler) setStatus(sub *Subscription, status SubscriptionStatus) error {
+	from := sub.Status
+	sub.Status = status
+	sub.UpdatedAt = time.Now()
+	if err := s.store.Save(*sub); err != nil {
+		return err
+	}
+	if from != status && s.opts.OnStatusChanged != nil {
+		s.opts.OnStatusChanged(*sub, from)
+	}
+	return nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,176 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+	"github.com/kabachoksolutions/rozetkapay/rozetkapaytest"
+)
+
+var testPlan = rozetkapay.Plan{
+	ID:       "monthly",
+	Name:     "Monthly plan",
+	Amount:   rozetkapay.Money{Amount: 1300, Currency: "UAH"},
+	Interval: rozetkapay.PlanInterval{Unit: rozetkapay.IntervalMonth, Count: 1},
+}
+
+// Saves a card of the customer and returns its option id.
+func addCard(t *testing.T, c *rozetkapay.Client, customerID string) string {
+	t.Helper()
+	resp, err := c.AddWalletCustomerPayment(customerID, &rozetkapay.AddWalletCustomerSchema{
+		PaymentMethod: rozetkapay.PaymentMethod{
+			Type:    rozetkapay.PaymentMethodTypeCCToken,
+			CCToken: rozetkapay.CCToken{Token: "tok_visa"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.PaymentMethod.OptionID
+}
+
+func subscribe(t *testing.T, c *rozetkapay.Client) (*rozetkapay.SubscriptionScheduler, *rozetkapay.MemorySubscriptionStore, string) {
+	t.Helper()
+	store := rozetkapay.NewMemorySubscriptionStore()
+	scheduler := rozetkapay.NewSubscriptionScheduler(c, store, rozetkapay.SchedulerOptions{})
+	sub, err := scheduler.Subscribe("customer-1", addCard(t, c, "customer-1"), testPlan, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduler, store, sub.ID
+}
+
+func TestSubscriptionCharged(t *testing.T) {
+	_, c := newFakeClient(t)
+	scheduler, store, id := subscribe(t, c)
+
+	if _, err := scheduler.ChargeDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := store.Get(id)
+	if sub.Status != rozetkapay.SubscriptionStatusActive || sub.Period != 1 || !sub.PaidUntil.After(time.Now()) {
+		t.Fatalf("subscription %s, period %d, paid until %s", sub.Status, sub.Period, sub.PaidUntil)
+	}
+}
+
+func TestSubscriptionDeclineStartsDunning(t *testing.T) {
+	srv, c := newFakeClient(t)
+	scheduler, store, id := subscribe(t, c)
+	srv.AddScenarios(rozetkapaytest.Scenario{Amount: 13, StatusCode: rozetkapay.StatusCodeInsufficientFunds, HTTPStatus: 400})
+
+	if _, err := scheduler.ChargeDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sub, _ := store.Get(id)
+	if sub.Status != rozetkapay.SubscriptionStatusPastDue || sub.FailedAttempts != 1 || sub.LastStatusCode != rozetkapay.StatusCodeInsufficientFunds {
+		t.Fatalf("subscription %s after %d failed attempts, code %s", sub.Status, sub.FailedAttempts, sub.LastStatusCode)
+	}
+}
+
+func TestSubscriptionSetupErrorKeepsStatus(t *testing.T) {
+	srv, c := newFakeClient(t)
+	scheduler, store, id := subscribe(t, c)
+
+	wrong := rozetkapay.NewClient(srv.Config())
+	wrong.SetCredentials(rozetkapay.Credentials{Login: "merchant", Password: "wrong"})
+	bad := rozetkapay.NewSubscriptionScheduler(wrong, store, rozetkapay.SchedulerOptions{})
+	for i := 0; i < 5; i++ {
+		if _, err := bad.ChargeDue(context.Background()); err == nil {
+			t.Fatal("charge with wrong credentials succeeded")
+		}
+		sub, _ := store.Get(id)
+		sub.NextChargeAt = time.Now()
+		store.Save(sub)
+	}
+
+	sub, _ := store.Get(id)
+	if sub.Status != rozetkapay.SubscriptionStatusActive || sub.FailedAttempts != 0 || sub.LastStatusCode != "" {
+		t.Fatalf("subscription %s after %d failed attempts, code %s", sub.Status, sub.FailedAttempts, sub.LastStatusCode)
+	}
+
+	// The subscription is charged once the setup is fixed.
+	if _, err := scheduler.ChargeDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sub, _ = store.Get(id); sub.Period != 1 {
+		t.Fatalf("subscription not charged after the setup was fixed: %+v", sub)
+	}
+}
+
+func TestSubscriptionChargeFoundByLookup(t *testing.T) {
+	_, c := newFakeClient(t)
+	_, store, id := subscribe(t, c)
+	sub, _ := store.Get(id)
+
+	// An earlier run created the charge but stopped before recording it.
+	if _, err := c.CreatePayment(&rozetkapay.CreatePaymentSchema{
+		ExternalID: id + "-1",
+		Amount:     13,
+		Currency:   "UAH",
+		Mode:       rozetkapay.PaymentModeDirect,
+		Confirm:    true,
+		Customer: &rozetkapay.CustomerData{
+			ExternalID: sub.CustomerID,
+			PaymentMethod: rozetkapay.PaymentMethod{
+				Type:   rozetkapay.PaymentMethodTypeWallet,
+				Wallet: rozetkapay.Wallet{OptionID: sub.OptionID},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		charged bool
+		resp    *rozetkapay.PaymentResponse
+	)
+	scheduler := rozetkapay.NewSubscriptionScheduler(c, store, rozetkapay.SchedulerOptions{
+		OnCharged: func(_ rozetkapay.Subscription, r *rozetkapay.PaymentResponse) { charged, resp = true, r },
+	})
+	if _, err := scheduler.ChargeDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !charged || resp != nil {
+		t.Fatalf("OnCharged called %v with %v", charged, resp)
+	}
+	if sub, _ = store.Get(id); sub.Period != 1 || sub.LastExternalID != id+"-1" {
+		t.Fatalf("subscription period %d, last charge %s", sub.Period, sub.LastExternalID)
+	}
+}
+
+func TestSubscriptionChargeDueCancelsInFlightCall(t *testing.T) {
+	block := make(chan struct{})
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-block:
+		}
+	}))
+	defer gateway.Close()
+	defer close(block)
+
+	_, c := newFakeClient(t)
+	_, store, id := subscribe(t, c)
+
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	scheduler := rozetkapay.NewSubscriptionScheduler(rozetkapay.NewClient(cfg), store, rozetkapay.SchedulerOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := scheduler.ChargeDue(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("ChargeDue returned after %s", elapsed)
+	}
+	if sub, _ := store.Get(id); sub.Status != rozetkapay.SubscriptionStatusActive || sub.Charges != 0 {
+		t.Fatalf("subscription %s after %d charges", sub.Status, sub.Charges)
+	}
+}
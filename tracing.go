@@ -0,0 +1,177 @@
+package rozetkapay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span attribute keys set by the client.
+const (
+	SpanAttributeOperation  = "rozetkapay.operation"
+	SpanAttributeExternalID = "rozetkapay.external_id"
+	SpanAttributePaymentID  = "rozetkapay.payment_id"
+	SpanAttributeErrorCode  = "rozetkapay.error_code"
+	SpanAttributeHTTPStatus = "http.status_code"
+)
+
+// Tracer creates spans around gateway calls and callback handling.
+// It is intentionally small so it can be adapted to OpenTelemetry or any other tracing library.
+type Tracer interface {
+	// Starts a new span as a child of the span carried by ctx.
+	Start(ctx context.Context, name string) (context.Context, Span)
+
+	// Writes the trace context carried by ctx into the headers of an outgoing request.
+	Inject(ctx context.Context, header http.Header)
+
+	// Reads the trace context from the headers of an incoming request.
+	Extract(ctx context.Context, header http.Header) context.Context
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// NoopTracer is the default tracer of the client, it records nothing.
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (NoopTracer) Inject(ctx context.Context, header http.Header) {}
+
+func (NoopTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	return ctx
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) RecordError(err error)                      {}
+func (noopSpan) End()                                       {}
+
+// RecordedSpan is a span finished by RecordingTracer.
+type RecordedSpan struct {
+	Name       string
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Attributes map[string]interface{}
+	Err        error
+	StartedAt  time.Time
+	EndedAt    time.Time
+}
+
+// RecordingTracer keeps finished spans in memory and propagates the W3C traceparent header.
+// It is meant for tests.
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+type spanContextKey struct{}
+
+type spanContext struct {
+	traceID string
+	spanID  string
+}
+
+func (t *RecordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordingSpan{
+		tracer: t,
+		span: RecordedSpan{
+			Name:       name,
+			SpanID:     randomHex(8),
+			Attributes: map[string]interface{}{},
+			StartedAt:  time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(spanContext); ok {
+		s.span.TraceID = parent.traceID
+		s.span.ParentID = parent.spanID
+	} else {
+		s.span.TraceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanContextKey{}, spanContext{s.span.TraceID, s.span.SpanID}), s
+}
+
+func (t *RecordingTracer) Inject(ctx context.Context, header http.Header) {
+	if sc, ok := ctx.Value(spanContextKey{}).(spanContext); ok {
+		header.Set("traceparent", "00-"+sc.traceID+"-"+sc.spanID+"-01")
+	}
+}
+
+func (t *RecordingTracer) Extract(ctx context.Context, header http.Header) context.Context {
+	parts := strings.Split(header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, spanContext{parts[1], parts[2]})
+}
+
+// Returns the finished spans in the order they were ended.
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+func (t *RecordingTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+type recordingSpan struct {
+	tracer *RecordingTracer
+	mu     sync.Mutex
+	span   RecordedSpan
+	ended  bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.span.Attributes[key] = value
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.span.Err = err
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.EndedAt = time.Now()
+	span := s.span
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, span)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,185 @@
+package rozetkapay_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kabachoksolutions/rozetkapay"
+)
+
+// Returns the only recorded span with the name.
+func spanNamed(t *testing.T, tracer *rozetkapay.RecordingTracer, name string) rozetkapay.RecordedSpan {
+	t.Helper()
+	var found []rozetkapay.RecordedSpan
+	for _, s := range tracer.Spans() {
+		if s.Name == name {
+			found = append(found, s)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("%d spans named %s", len(found), name)
+	}
+	return found[0]
+}
+
+func tracedClient(t *testing.T, handler http.HandlerFunc) (*rozetkapay.Client, *rozetkapay.RecordingTracer) {
+	t.Helper()
+	gateway := httptest.NewServer(handler)
+	t.Cleanup(gateway.Close)
+	cfg := rozetkapay.NewConfig("merchant", "secret")
+	cfg.API = gateway.URL + "/"
+	tracer := rozetkapay.NewRecordingTracer()
+	return rozetkapay.NewClient(cfg, rozetkapay.WithTracer(tracer)), tracer
+}
+
+func TestSendSpan(t *testing.T) {
+	var traceparent string
+	c, tracer := tracedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"id":"p1","external_id":"order-1","details":{"payment_id":"p1","status":"success"}}`))
+	})
+
+	ctx, parent := tracer.Start(context.Background(), "checkout")
+	_, err := rozetkapay.Do(ctx, c, rozetkapay.CreatePaymentEndpoint, &rozetkapay.CreatePaymentSchema{
+		ExternalID: "order-1", Amount: 100, Currency: "UAH", Mode: rozetkapay.PaymentModeHosted,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	checkout := spanNamed(t, tracer, "checkout")
+	span := spanNamed(t, tracer, "rozetkapay.create_payment")
+	if span.TraceID != checkout.TraceID || span.ParentID != checkout.SpanID {
+		t.Fatalf("span %s/%s is not a child of %s/%s", span.TraceID, span.ParentID, checkout.TraceID, checkout.SpanID)
+	}
+	if want := "00-" + span.TraceID + "-" + span.SpanID + "-01"; traceparent != want {
+		t.Fatalf("traceparent %q, want %q", traceparent, want)
+	}
+	want := map[string]interface{}{
+		rozetkapay.SpanAttributeOperation:  "create_payment",
+		rozetkapay.SpanAttributeExternalID: "order-1",
+		rozetkapay.SpanAttributePaymentID:  "p1",
+		rozetkapay.SpanAttributeHTTPStatus: 200,
+	}
+	for key, v := range want {
+		if span.Attributes[key] != v {
+			t.Errorf("attribute %s = %v, want %v", key, span.Attributes[key], v)
+		}
+	}
+	if span.Err != nil || span.EndedAt.Before(span.StartedAt) {
+		t.Fatalf("span error %v, started %s, ended %s", span.Err, span.StartedAt, span.EndedAt)
+	}
+}
+
+func TestSendSpanRecordsErrors(t *testing.T) {
+	c, tracer := tracedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"code":"transaction_declined","message":"declined"}`))
+	})
+
+	if _, err := c.GetPaymentInfo("order-1"); err == nil {
+		t.Fatal("declined call succeeded")
+	}
+	span := spanNamed(t, tracer, "rozetkapay.get_payment_info")
+	var errResp *rozetkapay.ErrorResponse
+	if !errors.As(span.Err, &errResp) {
+		t.Fatalf("span error %v", span.Err)
+	}
+	if span.Attributes[rozetkapay.SpanAttributeErrorCode] != "transaction_declined" ||
+		span.Attributes[rozetkapay.SpanAttributeHTTPStatus] != http.StatusBadRequest ||
+		span.Attributes[rozetkapay.SpanAttributeExternalID] != "order-1" {
+		t.Fatalf("attributes %v", span.Attributes)
+	}
+	if span.TraceID == "" || span.ParentID != "" {
+		t.Fatalf("root span trace %q, parent %q", span.TraceID, span.ParentID)
+	}
+
+	// Calls refused before reaching the gateway are recorded as well.
+	tracer.Reset()
+	sandbox := rozetkapay.NewConfig("merchant", "secret").SetEnvironment(rozetkapay.EnvironmentSandbox)
+	c = rozetkapay.NewClient(sandbox, rozetkapay.WithTracer(tracer))
+	if _, err := c.RefundPayment(&rozetkapay.RefundPaymentSchema{ExternalID: "order-1", Amount: 1, Currency: "UAH"}); err == nil {
+		t.Fatal("refund with production credentials in the sandbox succeeded")
+	}
+	if span := spanNamed(t, tracer, "rozetkapay.refund_payment"); !errors.Is(span.Err, rozetkapay.ErrEnvironmentMismatch) {
+		t.Fatalf("span error %v", span.Err)
+	}
+}
+
+func callbackRequest(body, traceparent string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	if traceparent != "" {
+		r.Header.Set("traceparent", traceparent)
+	}
+	return r
+}
+
+func TestCallbackSpansContinueTrace(t *testing.T) {
+	tracer := rozetkapay.NewRecordingTracer()
+	c := rozetkapay.NewClient(rozetkapay.NewDevelopmentConfig(), rozetkapay.WithTracer(tracer))
+	const (
+		traceID  = "0af7651916cd43dd8448eb211c80319c"
+		parentID = "b7ad6b7169203331"
+	)
+	traceparent := "00-" + traceID + "-" + parentID + "-01"
+
+	if _, err := c.GetPaymentCallbackFromRequest(callbackRequest(samplePaymentCallback, traceparent)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetWalletCallbackFromRequest(callbackRequest(sampleWalletCallback, traceparent)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DecodeCallbackRequest(callbackRequest(withOperation(t, sampleRefundCallback, "refund"), traceparent)); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("%d spans", len(spans))
+	}
+	wantOps := []string{"callback", "wallet_callback", "callback"}
+	wantIDs := []string{"order-1", "customer-1", "order-1"}
+	for i, s := range spans {
+		if s.Name != "rozetkapay.callback" || s.TraceID != traceID || s.ParentID != parentID {
+			t.Errorf("span %d: %s in trace %s under %s", i, s.Name, s.TraceID, s.ParentID)
+		}
+		if s.Attributes[rozetkapay.SpanAttributeOperation] != wantOps[i] || s.Attributes[rozetkapay.SpanAttributeExternalID] != wantIDs[i] {
+			t.Errorf("span %d attributes %v", i, s.Attributes)
+		}
+	}
+	if spans[0].Attributes[rozetkapay.SpanAttributePaymentID] != "2b5c1e0a4d" {
+		t.Errorf("payment id %v", spans[0].Attributes[rozetkapay.SpanAttributePaymentID])
+	}
+}
+
+func TestCallbackSpanErrors(t *testing.T) {
+	tracer := rozetkapay.NewRecordingTracer()
+	c := rozetkapay.NewClient(rozetkapay.NewDevelopmentConfig(), rozetkapay.WithTracer(tracer))
+
+	failed := strings.Replace(samplePaymentCallback, `"status": "success"`, `"status": "failure"`, 1)
+	failed = strings.Replace(failed, `"transaction_successful"`, `"insufficient_funds"`, 1)
+	if _, err := c.GetPaymentCallbackFromRequest(callbackRequest(failed, "00-bad")); err != nil {
+		t.Fatal(err)
+	}
+	span := tracer.Spans()[0]
+	if span.Attributes[rozetkapay.SpanAttributeErrorCode] != "insufficient_funds" {
+		t.Fatalf("attributes %v", span.Attributes)
+	}
+	// A malformed traceparent starts a new trace.
+	if span.TraceID == "" || span.ParentID != "" {
+		t.Fatalf("span trace %q, parent %q", span.TraceID, span.ParentID)
+	}
+
+	tracer.Reset()
+	if _, err := c.GetWalletCallbackFromRequest(callbackRequest(`{"status":`, "")); err == nil {
+		t.Fatal("invalid callback parsed")
+	}
+	if spans := tracer.Spans(); len(spans) != 1 || spans[0].Err == nil {
+		t.Fatalf("spans %+v", spans)
+	}
+}
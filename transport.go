@@ -0,0 +1,103 @@
+package rozetkapay
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the HTTP client built by NewClient.
+// Zero fields fall back to the values of DefaultTransportConfig.
+type TransportConfig struct {
+	// Overall time limit of a request, including reading the response body.
+	Timeout time.Duration
+
+	// Time limit of establishing a TCP connection.
+	DialTimeout time.Duration
+
+	// Interval of TCP keep-alive probes of open connections.
+	KeepAlive time.Duration
+
+	// Time limit of the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+
+	// Time limit of waiting for the response headers after the request was written.
+	ResponseHeaderTimeout time.Duration
+
+	// How long an idle connection stays in the pool.
+	IdleConnTimeout time.Duration
+
+	// Maximum number of idle connections across all hosts.
+	MaxIdleConns int
+
+	// Maximum number of idle connections to the gateway host.
+	MaxIdleConnsPerHost int
+
+	// Maximum number of connections to the gateway host, zero means no limit.
+	MaxConnsPerHost int
+}
+
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		Timeout:               30 * time.Second,
+		DialTimeout:           5 * time.Second,
+		KeepAlive:             30 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+	}
+}
+
+func (t TransportConfig) withDefaults() TransportConfig {
+	def := DefaultTransportConfig()
+	if t.Timeout <= 0 {
+		t.Timeout = def.Timeout
+	}
+	if t.DialTimeout <= 0 {
+		t.DialTimeout = def.DialTimeout
+	}
+	if t.KeepAlive <= 0 {
+		t.KeepAlive = def.KeepAlive
+	}
+	if t.TLSHandshakeTimeout <= 0 {
+		t.TLSHandshakeTimeout = def.TLSHandshakeTimeout
+	}
+	if t.ResponseHeaderTimeout <= 0 {
+		t.ResponseHeaderTimeout = def.ResponseHeaderTimeout
+	}
+	if t.IdleConnTimeout <= 0 {
+		t.IdleConnTimeout = def.IdleConnTimeout
+	}
+	if t.MaxIdleConns <= 0 {
+		t.MaxIdleConns = def.MaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost <= 0 {
+		t.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+	return t
+}
+
+func newHTTPClient(t TransportConfig) *http.Client {
+	t = t.withDefaults()
+	dialer := &net.Dialer{
+		Timeout:   t.DialTimeout,
+		KeepAlive: t.KeepAlive,
+	}
+	return &http.Client{
+		Timeout: t.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   t.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: t.ResponseHeaderTimeout,
+			IdleConnTimeout:       t.IdleConnTimeout,
+			MaxIdleConns:          t.MaxIdleConns,
+			MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       t.MaxConnsPerHost,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
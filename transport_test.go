@@ -0,0 +1,76 @@
+package rozetkapay
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func clientTransport(t *testing.T, c *Client) *http.Transport {
+	t.Helper()
+	tr, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport %T", c.httpClient.Transport)
+	}
+	return tr
+}
+
+func TestTransportConfigDefaults(t *testing.T) {
+	got := TransportConfig{Timeout: time.Second, MaxConnsPerHost: 4}.withDefaults()
+	want := DefaultTransportConfig()
+	want.Timeout, want.MaxConnsPerHost = time.Second, 4
+	if got != want {
+		t.Fatalf("withDefaults = %+v, want %+v", got, want)
+	}
+	if got := (TransportConfig{DialTimeout: -time.Second}).withDefaults(); got != DefaultTransportConfig() {
+		t.Fatalf("negative values kept: %+v", got)
+	}
+}
+
+func TestConfigTransport(t *testing.T) {
+	cfg := NewConfig("merchant", "secret").SetTransport(TransportConfig{
+		Timeout:             7 * time.Second,
+		TLSHandshakeTimeout: 2 * time.Second,
+		MaxIdleConnsPerHost: 3,
+		MaxConnsPerHost:     5,
+	})
+	c := NewClient(cfg)
+	if c.httpClient.Timeout != 7*time.Second {
+		t.Fatalf("timeout %s", c.httpClient.Timeout)
+	}
+	tr := clientTransport(t, c)
+	if tr.TLSHandshakeTimeout != 2*time.Second || tr.MaxIdleConnsPerHost != 3 || tr.MaxConnsPerHost != 5 {
+		t.Fatalf("transport %+v", tr)
+	}
+	// Fields left zero take the defaults.
+	def := DefaultTransportConfig()
+	if tr.ResponseHeaderTimeout != def.ResponseHeaderTimeout || tr.IdleConnTimeout != def.IdleConnTimeout || tr.MaxIdleConns != def.MaxIdleConns {
+		t.Fatalf("transport %+v, want defaults for unset fields", tr)
+	}
+}
+
+func TestWithTransportConfigOverridesConfig(t *testing.T) {
+	cfg := NewConfig("merchant", "secret").SetTransport(TransportConfig{Timeout: 7 * time.Second, MaxConnsPerHost: 5})
+	c := NewClient(cfg, WithTransportConfig(TransportConfig{Timeout: 3 * time.Second, ResponseHeaderTimeout: time.Second}))
+	if c.httpClient.Timeout != 3*time.Second {
+		t.Fatalf("timeout %s", c.httpClient.Timeout)
+	}
+	tr := clientTransport(t, c)
+	if tr.ResponseHeaderTimeout != time.Second || tr.MaxConnsPerHost != 0 {
+		t.Fatalf("transport %+v", tr)
+	}
+}
+
+func TestWithCustomHTTPClientOverridesTransport(t *testing.T) {
+	custom := &http.Client{Timeout: time.Minute}
+	cfg := NewConfig("merchant", "secret").SetTransport(TransportConfig{Timeout: 7 * time.Second})
+	for _, opts := range [][]ClientOpts{
+		{WithCustomHTTPClient(custom)},
+		{WithCustomHTTPClient(custom), WithTransportConfig(TransportConfig{Timeout: 3 * time.Second})},
+		{WithTransportConfig(TransportConfig{Timeout: 3 * time.Second}), WithCustomHTTPClient(custom)},
+	} {
+		if c := NewClient(cfg, opts...); c.httpClient != custom || custom.Timeout != time.Minute || custom.Transport != nil {
+			t.Fatalf("http client %+v, want the custom one untouched", c.httpClient)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package rozetkapay
+
+import (
+	"sort"
+	"time"
+)
+
+type WalletEventType string
+
+const (
+	// The card expires within the configured number of days.
+	WalletEventCardExpiring WalletEventType = "card_expiring"
+
+	WalletEventCardExpired WalletEventType = "card_expired"
+
+	// The payment option was deleted from the wallet, see WalletEvent.Reason.
+	WalletEventOptionDeleted WalletEventType = "option_deleted"
+)
+
+// Reasons a payment option is deleted for.
+const (
+	WalletDeleteReasonExpired   = "expired"
+	WalletDeleteReasonDuplicate = "duplicate"
+)
+
+// WalletEvent is emitted by WalletService for the notification system.
+type WalletEvent struct {
+	Type       WalletEventType `json:"type"`
+	CustomerID string          `json:"customer_id"`
+	Entry      WalletEntry     `json:"entry"`
+	Reason     string          `json:"reason,omitempty"`
+	At         time.Time       `json:"at"`
+}
+
+type WalletServiceOptions struct {
+	// Cards expiring within this number of days are reported as expiring, 30 if not set.
+	ExpiringWithinDays int
+
+	// Called for every event, synchronously.
+	OnEvent func(e WalletEvent)
+}
+
+// WalletService manages the saved payment options of customers.
+type WalletService struct {
+	client *Client
+	opts   WalletServiceOptions
+	now    func() time.Time
+}
+
+func NewWalletService(client *Client, opts WalletServiceOptions) *WalletService {
+	if opts.ExpiringWithinDays <= 0 {
+		opts.ExpiringWithinDays = 30
+	}
+	return &WalletService{client: client, opts: opts, now: time.Now}
+}
+
+// Returns the saved payment options of the customer, no options if the customer has no wallet yet.
+func (s *WalletService) List(customerID string) ([]WalletEntry, error) {
+	info, err := s.client.GetWalletCustomerPaymentInfo(customerID)
+	if code, ok := ErrorStatusCode(err); ok && code == StatusCodeCustomerProfileNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info.Wallet, nil
+}
+
+// Returns the option to charge the customer with: the preferred option if it is saved and not expired,
+// otherwise the card valid the longest. The boolean is false if there is no usable option.
+func (s *WalletService) Default(customerID, preferredOptionID string) (WalletEntry, bool, error) {
+	entries, err := s.List(customerID)
+	if err != nil {
+		return WalletEntry{}, false, err
+	}
+	entry, ok := DefaultWalletEntry(entries, preferredOptionID, s.now())
+	return entry, ok, nil
+}
+
+// Returns the cards that are expired or expire within the configured number of days,
+// emitting an event for each.
+func (s *WalletService) Expiring(customerID string) ([]WalletEntry, error) {
+	entries, err := s.List(customerID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	var expiring []WalletEntry
+	for _, entry := range entries {
+		switch {
+		case IsCardExpired(entry.Card, now):
+			s.emit(WalletEventCardExpired, customerID, entry, "")
+		case CardExpiresWithin(entry.Card, now, s.opts.ExpiringWithinDays):
+			s.emit(WalletEventCardExpiring, customerID, entry, "")
+		default:
+			continue
+		}
+		expiring = append(expiring, entry)
+	}
+	return expiring, nil
+}
+
+// Deletes expired cards and duplicates of the same card, keeping the kept option if given.
+// Returns the deleted options.
+func (s *WalletService) DeleteStale(customerID, keepOptionID string) ([]WalletEntry, error) {
+	entries, err := s.List(customerID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	var live []WalletEntry
+	var deleted []WalletEntry
+	for _, entry := range entries {
+		if entry.OptionID == keepOptionID || !IsCardExpired(entry.Card, now) {
+			live = append(live, entry)
+			continue
+		}
+		if err := s.delete(customerID, entry, WalletDeleteReasonExpired); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, entry)
+	}
+	for _, entry := range DuplicateWalletEntries(live, keepOptionID) {
+		if err := s.delete(customerID, entry, WalletDeleteReasonDuplicate); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, entry)
+	}
+	return deleted, nil
+}
+
+func (s *WalletService) delete(customerID string, entry WalletEntry, reason string) error {
+	_, err := s.client.DeleteWalletCustomerPayment(customerID, &DeleteWalletCustomerSchema{
+		OptionID: entry.OptionID,
+		Type:     PaymentMethodType(entry.Type),
+	})
+	if code, ok := ErrorStatusCode(err); ok && code == StatusCodePaymentMethodNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.emit(WalletEventOptionDeleted, customerID, entry, reason)
+	return nil
+}
+
+func (s *WalletService) emit(t WalletEventType, customerID string, entry WalletEntry, reason string) {
+	if s.opts.OnEvent == nil {
+		return
+	}
+	s.opts.OnEvent(WalletEvent{Type: t, CustomerID: customerID, Entry: entry, Reason: reason, At: s.now()})
+}
+
+// Reports whether the card is expired at the given time.
+func IsCardExpired(card Card, now time.Time) bool {
+	return !card.ExpiresAt.IsZero() && !card.ExpiresAt.After(now)
+}
+
+// Reports whether the card is still valid at the given time and expires within the given number of days.
+func CardExpiresWithin(card Card, now time.Time, days int) bool {
+	return !IsCardExpired(card, now) && !card.ExpiresAt.IsZero() && card.ExpiresAt.Before(now.AddDate(0, 0, days))
+}
+
+// Returns the entries saving the same card as an earlier entry, judged by type, mask and expiry month.
+// Entries without a card mask or expiry, such as Apple Pay and Google Pay options, are never duplicates.
+// The kept option is never reported as a duplicate.
+func DuplicateWalletEntries(entries []WalletEntry, keepOptionID string) []WalletEntry {
+	type cardKey struct {
+		typ         string
+		mask        string
+		year, month int
+	}
+	ordered := make([]WalletEntry, len(entries))
+	copy(ordered, entries)
+	// The kept option goes first so its duplicates are the ones reported.
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].OptionID == keepOptionID && ordered[j].OptionID != keepOptionID
+	})
+
+	seen := map[cardKey]bool{}
+	var duplicates []WalletEntry
+	for _, entry := range ordered {
+		if entry.Card.Mask == "" || entry.Card.ExpiresAt.IsZero() {
+			continue
+		}
+		y, m, _ := entry.Card.ExpiresAt.Date()
+		key := cardKey{typ: entry.Type, mask: entry.Card.Mask, year: y, month: int(m)}
+		if seen[key] {
+			duplicates = append(duplicates, entry)
+			continue
+		}
+		seen[key] = true
+	}
+	return duplicates
+}
+
+// Returns the preferred entry if it is present and not expired, otherwise the card valid the longest.
+func DefaultWalletEntry(entries []WalletEntry, preferredOptionID string, now time.Time) (WalletEntry, bool) {
+	var best WalletEntry
+	found := false
+	for _, entry := range entries {
+		if IsCardExpired(entry.Card, now) {
+			continue
+		}
+		if entry.OptionID == preferredOptionID && preferredOptionID != "" {
+			return entry, true
+		}
+		if !found || entry.Card.ExpiresAt.After(best.Card.ExpiresAt) {
+			best, found = entry, true
+		}
+	}
+	return best, found
+}
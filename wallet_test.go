@@ -0,0 +1,160 @@
+package rozetkapay_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kabachoksolutions/rozetkapay"
+	"github.com/kabachoksolutions/rozetkapay/rozetkapaytest"
+)
+
+// Saves the card of the token and returns its option id.
+func saveCard(t *testing.T, c *rozetkapay.Client, customerID, token string) string {
+	t.Helper()
+	resp, err := c.AddWalletCustomerPayment(customerID, cardSchema(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.PaymentMethod.OptionID
+}
+
+func setExpiry(t *testing.T, srv *rozetkapaytest.Server, customerID, optionID string, expiresAt time.Time) {
+	t.Helper()
+	if !srv.SetCardExpiry(customerID, optionID, expiresAt) {
+		t.Fatalf("card %s not found", optionID)
+	}
+}
+
+func optionIDs(entries []rozetkapay.WalletEntry) map[string]bool {
+	ids := map[string]bool{}
+	for _, e := range entries {
+		ids[e.OptionID] = true
+	}
+	return ids
+}
+
+func TestWalletListAndDefault(t *testing.T) {
+	srv, c := newFakeClient(t)
+	wallet := rozetkapay.NewWalletService(c, rozetkapay.WalletServiceOptions{})
+
+	if entries, err := wallet.List("customer-1"); err != nil || entries != nil {
+		t.Fatalf("List of an unknown customer = %v, %v", entries, err)
+	}
+	if _, ok, err := wallet.Default("customer-1", ""); ok || err != nil {
+		t.Fatalf("Default of an unknown customer = %v, %v", ok, err)
+	}
+
+	expired := saveCard(t, c, "customer-1", "tok_visa")
+	shorter := saveCard(t, c, "customer-1", "tok_mastercard")
+	longer := saveCard(t, c, "customer-1", "tok_amex")
+	setExpiry(t, srv, "customer-1", expired, time.Now().AddDate(0, -1, 0))
+	setExpiry(t, srv, "customer-1", shorter, time.Now().AddDate(1, 0, 0))
+
+	entries, err := wallet.List("customer-1")
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("List = %d entries, %v", len(entries), err)
+	}
+	if entry, ok, err := wallet.Default("customer-1", shorter); err != nil || !ok || entry.OptionID != shorter {
+		t.Fatalf("Default with a preferred card = %s, %v, %v", entry.OptionID, ok, err)
+	}
+	if entry, ok, err := wallet.Default("customer-1", expired); err != nil || !ok || entry.OptionID != longer {
+		t.Fatalf("Default with an expired preferred card = %s, %v, %v", entry.OptionID, ok, err)
+	}
+}
+
+func TestWalletExpiring(t *testing.T) {
+	srv, c := newFakeClient(t)
+	var events []rozetkapay.WalletEvent
+	wallet := rozetkapay.NewWalletService(c, rozetkapay.WalletServiceOptions{
+		ExpiringWithinDays: 30,
+		OnEvent:            func(e rozetkapay.WalletEvent) { events = append(events, e) },
+	})
+
+	expired := saveCard(t, c, "customer-1", "tok_visa")
+	expiring := saveCard(t, c, "customer-1", "tok_mastercard")
+	saveCard(t, c, "customer-1", "tok_amex")
+	setExpiry(t, srv, "customer-1", expired, time.Now().Add(-time.Hour))
+	setExpiry(t, srv, "customer-1", expiring, time.Now().AddDate(0, 0, 10))
+
+	entries, err := wallet.Expiring("customer-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := optionIDs(entries); len(ids) != 2 || !ids[expired] || !ids[expiring] {
+		t.Fatalf("expiring options %v", ids)
+	}
+	want := map[string]rozetkapay.WalletEventType{expired: rozetkapay.WalletEventCardExpired, expiring: rozetkapay.WalletEventCardExpiring}
+	if len(events) != 2 {
+		t.Fatalf("%d events", len(events))
+	}
+	for _, e := range events {
+		if e.Type != want[e.Entry.OptionID] || e.CustomerID != "customer-1" || e.At.IsZero() {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
+
+func TestWalletDeleteStale(t *testing.T) {
+	srv, c := newFakeClient(t)
+	var events []rozetkapay.WalletEvent
+	wallet := rozetkapay.NewWalletService(c, rozetkapay.WalletServiceOptions{
+		OnEvent: func(e rozetkapay.WalletEvent) { events = append(events, e) },
+	})
+
+	// The same card saved twice, the second copy is the one in use.
+	first := saveCard(t, c, "customer-1", "tok_visa")
+	kept := saveCard(t, c, "customer-1", "tok_visa")
+	expired := saveCard(t, c, "customer-1", "tok_mastercard")
+	other := saveCard(t, c, "customer-1", "tok_amex")
+	setExpiry(t, srv, "customer-1", expired, time.Now().AddDate(0, -1, 0))
+
+	deleted, err := wallet.DeleteStale("customer-1", kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := optionIDs(deleted); len(ids) != 2 || !ids[first] || !ids[expired] {
+		t.Fatalf("deleted options %v", ids)
+	}
+	reasons := map[string]string{}
+	for _, e := range events {
+		if e.Type != rozetkapay.WalletEventOptionDeleted {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		reasons[e.Entry.OptionID] = e.Reason
+	}
+	if reasons[first] != rozetkapay.WalletDeleteReasonDuplicate || reasons[expired] != rozetkapay.WalletDeleteReasonExpired {
+		t.Fatalf("delete reasons %v", reasons)
+	}
+
+	entries, err := wallet.List("customer-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := optionIDs(entries); len(ids) != 2 || !ids[kept] || !ids[other] {
+		t.Fatalf("remaining options %v", ids)
+	}
+}
+
+func TestDuplicateWalletEntries(t *testing.T) {
+	expires := time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC)
+	card := func(id, typ, mask string, expiresAt time.Time) rozetkapay.WalletEntry {
+		return rozetkapay.WalletEntry{OptionID: id, Type: typ, Card: rozetkapay.Card{Mask: mask, ExpiresAt: expiresAt}}
+	}
+	entries := []rozetkapay.WalletEntry{
+		card("apple", "apple_pay", "", time.Time{}),
+		card("google", "google_pay", "", time.Time{}),
+		card("no-expiry-1", "cc_token", "424242******4242", time.Time{}),
+		card("no-expiry-2", "cc_token", "424242******4242", time.Time{}),
+		card("card-1", "cc_token", "424242******4242", expires),
+		card("card-2", "cc_token", "424242******4242", expires.AddDate(0, 0, 10)),
+		card("card-wallet", "wallet", "424242******4242", expires),
+		card("card-renewed", "cc_token", "424242******4242", expires.AddDate(0, 1, 0)),
+	}
+
+	if ids := optionIDs(rozetkapay.DuplicateWalletEntries(entries, "")); len(ids) != 1 || !ids["card-2"] {
+		t.Fatalf("duplicates %v", ids)
+	}
+	if ids := optionIDs(rozetkapay.DuplicateWalletEntries(entries, "card-2")); len(ids) != 1 || !ids["card-1"] {
+		t.Fatalf("duplicates keeping card-2 %v", ids)
+	}
+}